@@ -1,17 +1,47 @@
 package main
 
 import (
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/rs/zerolog"
 
 	"github.com/mannulus-immortalis/xmtask/internal/api"
 	"github.com/mannulus-immortalis/xmtask/internal/api/auth"
+	"github.com/mannulus-immortalis/xmtask/internal/cache"
 	"github.com/mannulus-immortalis/xmtask/internal/db"
+	"github.com/mannulus-immortalis/xmtask/internal/events"
+	"github.com/mannulus-immortalis/xmtask/internal/importer"
 	"github.com/mannulus-immortalis/xmtask/internal/kafka"
+	"github.com/mannulus-immortalis/xmtask/internal/memory"
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+	"github.com/mannulus-immortalis/xmtask/internal/notify"
+	"github.com/mannulus-immortalis/xmtask/internal/webhook"
+)
+
+const (
+	defaultEventsLogSize = 1000
+	defaultNotifySinks   = "kafka:log,webhook:log"
+
+	// only PostgreSQL storage has webhook subscriptions
+	defaultStorageOnlyNotifySinks = "kafka:log"
+
+	defaultReadYourWritesWindow = 5 * time.Second
+
+	defaultSimilarityThreshold = 0.5
+	defaultStrictThreshold     = 0.8
+
+	defaultDBRetryAttempts = 3
+	defaultDBRetryBackoff  = 50 * time.Millisecond
+
+	schemeMemory = "memory"
+	schemeSQLite = "sqlite"
 )
 
 func main() {
@@ -23,36 +53,307 @@ func main() {
 	if dbDSN == "" {
 		log.Fatal().Msg("DB_DSN env value is empty, see user manual for configuration description")
 	}
+	dbScheme, dbPath, _ := strings.Cut(dbDSN, "://")
+	// audit log, import jobs and webhooks are kept in PostgreSQL only
+	storageOnly := dbScheme == schemeMemory || dbScheme == schemeSQLite
+	sinksConf := os.Getenv("NOTIFY_SINKS")
+	if sinksConf == "" {
+		sinksConf = defaultNotifySinks
+		if storageOnly {
+			sinksConf = defaultStorageOnlyNotifySinks
+		}
+	}
+	sinks, err := notify.ParseSinks(sinksConf)
+	if err != nil {
+		log.Fatal().Str("NOTIFY_SINKS", sinksConf).Msg("NOTIFY_SINKS env value is invalid, see user manual for configuration description")
+	}
 	kafkaHost := os.Getenv("KAFKA_HOST")
 	kafkaTopic := os.Getenv("KAFKA_TOPIC")
-	if kafkaHost == "" || kafkaTopic == "" {
-		log.Fatal().Msg("Some env values for Kafka are missing, see user manual for configuration description")
+	notifyFile := os.Getenv("NOTIFY_FILE")
+	deadLetterFile := os.Getenv("NOTIFY_DEAD_LETTER_FILE")
+	for _, s := range sinks {
+		if s.Name == notify.SinkKafka && (kafkaHost == "" || kafkaTopic == "") {
+			log.Fatal().Msg("Some env values for Kafka are missing, see user manual for configuration description")
+		}
+		if s.Name == notify.SinkFile && notifyFile == "" {
+			log.Fatal().Msg("NOTIFY_FILE env value is empty, see user manual for configuration description")
+		}
+		if s.Name == notify.SinkWebhook && storageOnly {
+			log.Fatal().Msg("webhook sink requires PostgreSQL storage, see user manual for configuration description")
+		}
 	}
 	jwtKey := os.Getenv("JWT_KEY")
 	if jwtKey == "" {
 		log.Fatal().Msg("JWT_KEY env value is empty, see user manual for configuration description")
 	}
+	apiOpts := []api.Option{}
+	if v := os.Getenv("BATCH_MAX_SIZE"); v != "" {
+		batchMaxSize, err := strconv.Atoi(v)
+		if err != nil || batchMaxSize < 1 {
+			log.Fatal().Str("BATCH_MAX_SIZE", v).Msg("BATCH_MAX_SIZE env value is invalid, see user manual for configuration description")
+		}
+		apiOpts = append(apiOpts, api.WithBatchLimit(batchMaxSize))
+	}
+	if v := os.Getenv("CORS_ALLOWED_ORIGINS"); v != "" {
+		origins := strings.Split(v, ",")
+		for n, origin := range origins {
+			origin = strings.TrimSpace(origin)
+			u, err := url.Parse(origin)
+			if origin != "*" && (err != nil || u.Scheme == "" || u.Host == "") {
+				log.Fatal().Str("CORS_ALLOWED_ORIGINS", v).Msg("CORS_ALLOWED_ORIGINS env value is invalid, see user manual for configuration description")
+			}
+			origins[n] = origin
+		}
+		apiOpts = append(apiOpts, api.WithAllowedOrigins(origins))
+	}
+	if v := os.Getenv("BATCH_GET_MAX_SIZE"); v != "" {
+		batchGetMaxSize, err := strconv.Atoi(v)
+		if err != nil || batchGetMaxSize < 1 {
+			log.Fatal().Str("BATCH_GET_MAX_SIZE", v).Msg("BATCH_GET_MAX_SIZE env value is invalid, see user manual for configuration description")
+		}
+		apiOpts = append(apiOpts, api.WithBatchGetLimit(batchGetMaxSize))
+	}
+	eventsLogSize := defaultEventsLogSize
+	if v := os.Getenv("EVENTS_LOG_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatal().Str("EVENTS_LOG_SIZE", v).Msg("EVENTS_LOG_SIZE env value is invalid, see user manual for configuration description")
+		}
+		eventsLogSize = n
+	}
+	if v := os.Getenv("STATS_CACHE_TTL"); v != "" {
+		statsTTL, err := time.ParseDuration(v)
+		if err != nil || statsTTL < 0 {
+			log.Fatal().Str("STATS_CACHE_TTL", v).Msg("STATS_CACHE_TTL env value is invalid, see user manual for configuration description")
+		}
+		apiOpts = append(apiOpts, api.WithStatsTTL(statsTTL))
+	}
+	var webhookOpts []webhook.Option
+	if v := os.Getenv("WEBHOOK_DELIVERY_RETENTION"); v != "" {
+		retention, err := time.ParseDuration(v)
+		if err != nil || retention < 0 {
+			log.Fatal().Str("WEBHOOK_DELIVERY_RETENTION", v).Msg("WEBHOOK_DELIVERY_RETENTION env value is invalid, see user manual for configuration description")
+		}
+		webhookOpts = append(webhookOpts, webhook.WithDeliveryRetention(retention))
+	}
+	similarityThreshold, strictThreshold := defaultSimilarityThreshold, defaultStrictThreshold
+	if v := os.Getenv("SIMILARITY_THRESHOLD"); v != "" {
+		similarityThreshold, err = strconv.ParseFloat(v, 64)
+		if err != nil || !(similarityThreshold >= 0 && similarityThreshold <= 1) {
+			log.Fatal().Str("SIMILARITY_THRESHOLD", v).Msg("SIMILARITY_THRESHOLD env value is invalid, see user manual for configuration description")
+		}
+	}
+	if v := os.Getenv("SIMILARITY_STRICT_THRESHOLD"); v != "" {
+		strictThreshold, err = strconv.ParseFloat(v, 64)
+		if err != nil || !(strictThreshold >= similarityThreshold && strictThreshold <= 1) {
+			log.Fatal().Str("SIMILARITY_STRICT_THRESHOLD", v).Msg("SIMILARITY_STRICT_THRESHOLD env value is invalid, see user manual for configuration description")
+		}
+	}
+	apiOpts = append(apiOpts, api.WithSimilarity(similarityThreshold, strictThreshold))
+
+	dbOpts := []db.Option{}
+	if v := os.Getenv("DB_REPLICA_DSNS"); v != "" {
+		if storageOnly {
+			log.Fatal().Msg("DB_REPLICA_DSNS requires PostgreSQL storage, see user manual for configuration description")
+		}
+		dbOpts = append(dbOpts, db.WithReplicas(strings.Split(v, ",")...))
+
+		window := defaultReadYourWritesWindow
+		if v := os.Getenv("READ_YOUR_WRITES_WINDOW"); v != "" {
+			window, err = time.ParseDuration(v)
+			if err != nil || window < 0 {
+				log.Fatal().Str("READ_YOUR_WRITES_WINDOW", v).Msg("READ_YOUR_WRITES_WINDOW env value is invalid, see user manual for configuration description")
+			}
+		}
+		apiOpts = append(apiOpts, api.WithReadYourWrites(window))
+	}
+	var maxOpen, maxIdle int
+	var maxLifetime time.Duration
+	if v := os.Getenv("DB_MAX_OPEN_CONNS"); v != "" {
+		maxOpen, err = strconv.Atoi(v)
+		if err != nil || maxOpen < 0 {
+			log.Fatal().Str("DB_MAX_OPEN_CONNS", v).Msg("DB_MAX_OPEN_CONNS env value is invalid, see user manual for configuration description")
+		}
+	}
+	if v := os.Getenv("DB_MAX_IDLE_CONNS"); v != "" {
+		maxIdle, err = strconv.Atoi(v)
+		if err != nil || maxIdle < 0 {
+			log.Fatal().Str("DB_MAX_IDLE_CONNS", v).Msg("DB_MAX_IDLE_CONNS env value is invalid, see user manual for configuration description")
+		}
+	}
+	if v := os.Getenv("DB_CONN_MAX_LIFETIME"); v != "" {
+		maxLifetime, err = time.ParseDuration(v)
+		if err != nil || maxLifetime < 0 {
+			log.Fatal().Str("DB_CONN_MAX_LIFETIME", v).Msg("DB_CONN_MAX_LIFETIME env value is invalid, see user manual for configuration description")
+		}
+	}
+	dbOpts = append(dbOpts, db.WithPool(maxOpen, maxIdle, maxLifetime))
+	if v := os.Getenv("DB_STATEMENT_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			log.Fatal().Str("DB_STATEMENT_TIMEOUT", v).Msg("DB_STATEMENT_TIMEOUT env value is invalid, see user manual for configuration description")
+		}
+		dbOpts = append(dbOpts, db.WithStatementTimeout(timeout))
+	}
+	retryAttempts, retryBackoff := defaultDBRetryAttempts, defaultDBRetryBackoff
+	if v := os.Getenv("DB_RETRY_ATTEMPTS"); v != "" {
+		retryAttempts, err = strconv.Atoi(v)
+		if err != nil || retryAttempts < 1 {
+			log.Fatal().Str("DB_RETRY_ATTEMPTS", v).Msg("DB_RETRY_ATTEMPTS env value is invalid, see user manual for configuration description")
+		}
+	}
+	if v := os.Getenv("DB_RETRY_BACKOFF"); v != "" {
+		retryBackoff, err = time.ParseDuration(v)
+		if err != nil || retryBackoff <= 0 {
+			log.Fatal().Str("DB_RETRY_BACKOFF", v).Msg("DB_RETRY_BACKOFF env value is invalid, see user manual for configuration description")
+		}
+	}
+	dbOpts = append(dbOpts, db.WithRetries(retryAttempts, retryBackoff))
+	if v := os.Getenv("DB_HEALTH_CHECK_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			log.Fatal().Str("DB_HEALTH_CHECK_INTERVAL", v).Msg("DB_HEALTH_CHECK_INTERVAL env value is invalid, see user manual for configuration description")
+		}
+		dbOpts = append(dbOpts, db.WithHealthCheck(interval))
+	}
+	var stripSuffixes bool
+	if v := os.Getenv("NAME_STRIP_LEGAL_SUFFIXES"); v != "" {
+		stripSuffixes, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal().Str("NAME_STRIP_LEGAL_SUFFIXES", v).Msg("NAME_STRIP_LEGAL_SUFFIXES env value is invalid, see user manual for configuration description")
+		}
+	}
+	if stripSuffixes {
+		dbOpts = append(dbOpts, db.WithLegalSuffixStripping())
+	}
+	var cacheSize int
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		cacheSize, err = strconv.Atoi(v)
+		if err != nil || cacheSize < 0 {
+			log.Fatal().Str("CACHE_SIZE", v).Msg("CACHE_SIZE env value is invalid, see user manual for configuration description")
+		}
+	}
+	cacheOpts := []cache.Option{cache.WithSize(cacheSize)}
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			log.Fatal().Str("CACHE_TTL", v).Msg("CACHE_TTL env value is invalid, see user manual for configuration description")
+		}
+		cacheOpts = append(cacheOpts, cache.WithTTL(ttl))
+	}
+	if v := os.Getenv("CACHE_NEGATIVE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl < 0 {
+			log.Fatal().Str("CACHE_NEGATIVE_TTL", v).Msg("CACHE_NEGATIVE_TTL env value is invalid, see user manual for configuration description")
+		}
+		cacheOpts = append(cacheOpts, cache.WithNegativeTTL(ttl))
+	}
+	var cacheKafka bool
+	if v := os.Getenv("CACHE_KAFKA_INVALIDATION"); v != "" {
+		cacheKafka, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal().Str("CACHE_KAFKA_INVALIDATION", v).Msg("CACHE_KAFKA_INVALIDATION env value is invalid, see user manual for configuration description")
+		}
+		if cacheKafka && (kafkaHost == "" || kafkaTopic == "") {
+			log.Fatal().Msg("Some env values for Kafka are missing, see user manual for configuration description")
+		}
+	}
 
 	// init deps
-	dbConn, err := db.New(dbDSN)
-	if err != nil {
-		log.Fatal().Err(err).Msg("DB connect failed")
+	var (
+		stor     models.StorageInt
+		jobs     models.JobStorageInt
+		webhooks models.WebhookStorageInt
+	)
+	switch dbScheme {
+	case schemeMemory:
+		var memOpts []memory.Option
+		if stripSuffixes {
+			memOpts = append(memOpts, memory.WithLegalSuffixStripping())
+		}
+		stor = memory.New(memOpts...)
+	case schemeSQLite:
+		dbConn, err := db.NewSQLite(dbPath, dbOpts...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("SQLite open failed")
+		}
+		defer dbConn.Close()
+		stor = dbConn
+	default:
+		dbConn, err := db.New(dbDSN, dbOpts...)
+		if err != nil {
+			log.Fatal().Err(err).Msg("DB connect failed")
+		}
+		defer dbConn.Close()
+		stor, jobs, webhooks = dbConn, dbConn, dbConn
+		apiOpts = append(apiOpts, api.WithAudit(dbConn))
+		// subscriptions could be managed only if something delivers to them
+		if notify.HasSink(sinks, notify.SinkWebhook) {
+			apiOpts = append(apiOpts, api.WithWebhooks(dbConn))
+		}
+	}
+	if cacheSize > 0 {
+		cached := cache.New(stor, cacheOpts...)
+		stor = cached
+		apiOpts = append(apiOpts, api.WithCacheStats(cached))
+
+		// writes of other instances come back as our own Kafka events
+		if cacheKafka {
+			l, err := kafka.NewListener(&log, kafkaHost, kafkaTopic, func(e models.EventNotifications) {
+				cached.Invalidate(e.ID)
+				if e.MergedFrom != nil {
+					cached.Invalidate(*e.MergedFrom)
+				}
+			})
+			if err != nil {
+				log.Fatal().Err(err).Msg("kafka listener setup failed")
+			}
+			defer l.Close()
+		}
 	}
-	defer dbConn.Close()
 
 	jwtAuth, err := auth.New(jwtKey)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Invalid HS256 key")
 	}
 
-	kafkaNotifier, err := kafka.New(&log, kafkaHost, kafkaTopic)
+	for n := range sinks {
+		switch sinks[n].Name {
+		case notify.SinkKafka:
+			sinks[n].Notifier, err = kafka.New(&log, kafkaHost, kafkaTopic)
+			if err != nil {
+				log.Fatal().Err(err).Msg("kafka setup failed")
+			}
+		case notify.SinkWebhook:
+			sinks[n].Notifier = webhook.New(&log, webhooks, webhookOpts...)
+		case notify.SinkLog:
+			sinks[n].Notifier = notify.NewLog(&log)
+		case notify.SinkFile:
+			sinks[n].Notifier, err = notify.NewFile(notifyFile)
+			if err != nil {
+				log.Fatal().Err(err).Msg("notification file open failed")
+			}
+		}
+	}
+	multiNotifier, err := notify.New(&log, deadLetterFile, sinks)
 	if err != nil {
-		log.Fatal().Err(err).Msg("kafka setup failed")
+		log.Fatal().Err(err).Msg("notification sinks setup failed")
+	}
+
+	// notifications go to configured sinks and to SSE subscribers
+	notifier := events.New(multiNotifier, eventsLogSize)
+	defer notifier.Close()
+
+	if jobs != nil {
+		imp := importer.New(&log, stor, jobs, notifier)
+		imp.Start()
+		defer imp.Close()
+		apiOpts = append(apiOpts, api.WithImporter(imp))
 	}
-	defer kafkaNotifier.Close()
 
 	// setup API
-	api := api.New(&log, dbConn, jwtAuth, kafkaNotifier)
+	apiOpts = append(apiOpts, api.WithEvents(notifier))
+	api := api.New(&log, stor, jwtAuth, notifier, apiOpts...)
 
 	// run server in background
 	serverErrors := make(chan error, 1)
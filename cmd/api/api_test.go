@@ -1,25 +1,37 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/rs/zerolog"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
 	"github.com/mannulus-immortalis/xmtask/internal/api"
 	"github.com/mannulus-immortalis/xmtask/internal/api/auth"
 	"github.com/mannulus-immortalis/xmtask/internal/db"
+	"github.com/mannulus-immortalis/xmtask/internal/events"
+	"github.com/mannulus-immortalis/xmtask/internal/importer"
+	"github.com/mannulus-immortalis/xmtask/internal/memory"
 	"github.com/mannulus-immortalis/xmtask/internal/models"
 	"github.com/mannulus-immortalis/xmtask/internal/models/mocks"
 )
@@ -29,7 +41,7 @@ const (
 )
 
 var (
-	errDuplicate = &pq.Error{Code: "23505"}
+	errDuplicate = &pq.Error{Code: "23505", Constraint: "companies_name_key_uniq"}
 )
 
 func TestCreateItem(t *testing.T) {
@@ -45,10 +57,16 @@ func TestCreateItem(t *testing.T) {
 			_ = conn.Close()
 		}()
 		dbConn := db.NewFromConn(conn)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config('pg_trgm.similarity_threshold', $1, true)`)).
+			WithArgs("0.5").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, similarity(name_key, $1) AS score FROM companies`)).
+			WithArgs("newcompany", 0.5, 5).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "score"}))
+		mock.ExpectRollback()
 		rows := sqlmock.NewRows([]string{"id"})
 		rows.AddRow(id.String())
-		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO companies (name, description, employee_count, is_registered, legal_type) VALUES ($1, $2, $3, $4, $5) RETURNING id`)).
-			WithArgs("newcompany", "", 15, false, "Corporations").WillReturnRows(rows)
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO companies (id, name, description, employee_count, is_registered, legal_type, name_key) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING RETURNING id`)).
+			WithArgs(sqlmock.AnyArg(), "newcompany", "", 15, false, "Corporations", "newcompany").WillReturnRows(rows)
 
 		// mock kafka
 		kafkaMock := mocks.NewNotifyInt(t)
@@ -95,8 +113,16 @@ func TestCreateItem(t *testing.T) {
 			_ = conn.Close()
 		}()
 		dbConn := db.NewFromConn(conn)
-		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO companies (name, description, employee_count, is_registered, legal_type) VALUES ($1, $2, $3, $4, $5) RETURNING id`)).
-			WithArgs("newcompany", "", 15, false, "Corporations").WillReturnError(errDuplicate)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config('pg_trgm.similarity_threshold', $1, true)`)).
+			WithArgs("0.5").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, similarity(name_key, $1) AS score FROM companies`)).
+			WithArgs("newcompany", 0.5, 5).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "score"}))
+		mock.ExpectRollback()
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO companies (id, name, description, employee_count, is_registered, legal_type, name_key) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING RETURNING id`)).
+			WithArgs(sqlmock.AnyArg(), "newcompany", "", 15, false, "Corporations", "newcompany").WillReturnError(errDuplicate)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM companies WHERE name_key = $1`)).WithArgs("newcompany").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4"))
 
 		// mock kafka
 		kafkaMock := mocks.NewNotifyInt(t)
@@ -128,7 +154,8 @@ func TestCreateItem(t *testing.T) {
 
 		// test result
 		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
-		assert.Equal(t, `{"error":"Duplicate item name"}`, string(respBody))
+		assert.Equal(t, `{"error":"Duplicate item name","conflicting_id":"3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4"}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("error_validation", func(t *testing.T) {
@@ -210,6 +237,51 @@ func TestCreateItem(t *testing.T) {
 		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
 		assert.Equal(t, `{"error":"Access denied"}`, string(respBody))
 	})
+
+	t.Run("success_notify_failed", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("SimilarItems", mock.Anything, "newcompany", mock.Anything, mock.Anything).Return(nil, nil)
+		dbConn.On("CreateItem", mock.Anything, mock.Anything).Return(&id, nil)
+
+		// mock kafka, failed notification is reported in Warning header
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", models.EventNotifications{ID: id, Event: models.EventTypeCreated}).Return(errors.New("kafka is down"))
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"name":"newcompany", "employee_count":15, "type":"Corporations"}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9081/api/v1/company", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result, the company is created, so the client must not retry
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, `199 - "Notification send failed"`, resp.Header.Get("Warning"))
+		assert.Equal(t, `{"id":"`+id.String()+`","name":"newcompany","employee_count":15,"is_registered":false,"type":"Corporations"}`, string(respBody))
+	})
 }
 
 func TestUpdateItem(t *testing.T) {
@@ -225,15 +297,19 @@ func TestUpdateItem(t *testing.T) {
 			_ = conn.Close()
 		}()
 		dbConn := db.NewFromConn(conn)
-		mock.ExpectExec(regexp.QuoteMeta(`UPDATE companies 
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		rows.AddRow(id.String(), "name", "description", 1, true, "Sole Proprietorship")
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE companies 
 	SET
 		name=COALESCE($2, name), 
 		description=COALESCE($3, description), 
 		employee_count=COALESCE($4, employee_count), 
 		is_registered=COALESCE($5, is_registered), 
-		legal_type=COALESCE($6, legal_type)
-	WHERE id = $1`)).
-			WithArgs(id, nil, nil, 1, nil, "Sole Proprietorship").WillReturnResult(sqlmock.NewResult(0, 1))
+		legal_type=COALESCE($6, legal_type),
+		name_key=COALESCE($7, name_key)
+	WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id, nil, nil, 1, nil, "Sole Proprietorship", nil).WillReturnRows(rows)
 
 		// mock kafka
 		kafkaMock := mocks.NewNotifyInt(t)
@@ -276,15 +352,17 @@ func TestUpdateItem(t *testing.T) {
 			_ = conn.Close()
 		}()
 		dbConn := db.NewFromConn(conn)
-		mock.ExpectExec(regexp.QuoteMeta(`UPDATE companies 
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE companies 
 	SET
 		name=COALESCE($2, name), 
 		description=COALESCE($3, description), 
 		employee_count=COALESCE($4, employee_count), 
 		is_registered=COALESCE($5, is_registered), 
-		legal_type=COALESCE($6, legal_type)
-	WHERE id = $1`)).
-			WithArgs(id, nil, nil, 1, nil, "Sole Proprietorship").WillReturnError(errDuplicate)
+		legal_type=COALESCE($6, legal_type),
+		name_key=COALESCE($7, name_key)
+	WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id, nil, nil, 1, nil, "Sole Proprietorship", nil).WillReturnError(errDuplicate)
 
 		// mock kafka
 		kafkaMock := mocks.NewNotifyInt(t)
@@ -319,6 +397,63 @@ func TestUpdateItem(t *testing.T) {
 		assert.Equal(t, `{"error":"Duplicate item name"}`, string(respBody))
 	})
 
+	t.Run("error_revision_conflict", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE companies 
+	SET
+		name=COALESCE($2, name), 
+		description=COALESCE($3, description), 
+		employee_count=COALESCE($4, employee_count), 
+		is_registered=COALESCE($5, is_registered), 
+		legal_type=COALESCE($6, legal_type),
+		name_key=COALESCE($7, name_key)
+	WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id, nil, nil, 1, nil, "Sole Proprietorship", nil).WillReturnError(&pq.Error{Code: "23505", Constraint: "company_revisions_pkey"})
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"employee_count":1, "type":"Sole Proprietorship"}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, "http://localhost:9082/api/v1/company/"+id.String(), bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(t, `{"error":"DB error"}`, string(respBody))
+	})
+
 	t.Run("error_validation", func(t *testing.T) {
 		ctx := context.Background()
 		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
@@ -374,8 +509,11 @@ func TestDeleteItem(t *testing.T) {
 			_ = conn.Close()
 		}()
 		dbConn := db.NewFromConn(conn)
-		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM companies WHERE id = $1`)).
-			WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		rows.AddRow(id.String(), "name", "description", 3, true, "Corporations")
+		mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM companies WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id).WillReturnRows(rows)
 
 		// mock kafka
 		kafkaMock := mocks.NewNotifyInt(t)
@@ -417,8 +555,10 @@ func TestDeleteItem(t *testing.T) {
 			_ = conn.Close()
 		}()
 		dbConn := db.NewFromConn(conn)
-		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM companies WHERE id = $1`)).
-			WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1)).WillReturnResult(sqlmock.NewResult(0, 0))
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM companies WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id).WillReturnRows(rows)
 
 		// mock kafka
 		kafkaMock := mocks.NewNotifyInt(t)
@@ -452,6 +592,59 @@ func TestDeleteItem(t *testing.T) {
 		assert.Equal(t, `{"error":"Item not found"}`, string(respBody))
 	})
 
+	t.Run("success_representation", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		rows.AddRow(id.String(), "name", "description", 3, true, "Corporations")
+		mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM companies WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id).WillReturnRows(rows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", models.EventNotifications{ID: id, Event: models.EventTypeDeleted}).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "http://localhost:9083/api/v1/company/"+id.String(), http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Prefer", "return=representation")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "return=representation", resp.Header.Get("Preference-Applied"))
+		assert.Equal(t, `{"id":"`+id.String()+`","name":"name","description":"description","employee_count":3,"is_registered":true,"type":"Corporations"}`, string(respBody))
+	})
+
 }
 
 func TestGetItem(t *testing.T) {
@@ -518,6 +711,8 @@ func TestGetItem(t *testing.T) {
 		dbConn := db.NewFromConn(conn)
 		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`)).
 			WithArgs(id).WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT target_id FROM company_merges WHERE source_id = $1`)).
+			WithArgs(id).WillReturnError(sql.ErrNoRows)
 
 		// mock kafka
 		kafkaMock := mocks.NewNotifyInt(t)
@@ -552,3 +747,3154 @@ func TestGetItem(t *testing.T) {
 	})
 
 }
+
+func TestDiffItem(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rowsFrom := sqlmock.NewRows([]string{"revision", "event", "data", "created_at"})
+		rowsFrom.AddRow(1, "created", []byte(`{"id":"`+id.String()+`","name":"name","description":"","employee_count":3,"is_registered":true,"type":"Corporations"}`), time.Now())
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision, event, data, created_at FROM company_revisions WHERE company_id = $1 AND revision = $2`)).
+			WithArgs(id, 1).WillReturnRows(rowsFrom)
+		rowsTo := sqlmock.NewRows([]string{"revision", "event", "data", "created_at"})
+		rowsTo.AddRow(2, "updated", []byte(`{"id":"`+id.String()+`","name":"name","description":"text","employee_count":5,"is_registered":true,"type":"Corporations"}`), time.Now())
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision, event, data, created_at FROM company_revisions WHERE company_id = $1 AND revision = $2`)).
+			WithArgs(id, 2).WillReturnRows(rowsTo)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/company/"+id.String()+"/diff?from=1&to=2", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"id":"`+id.String()+`","from":1,"to":2,"patch":[{"op":"replace","path":"/description","value":"text"},{"op":"replace","path":"/employee_count","value":5}]}`, string(respBody))
+	})
+
+	t.Run("error_validation", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/company/"+id.String()+"/diff?from=1", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, `{"error":"Invalid revision"}`, string(respBody))
+	})
+}
+
+func TestRollbackItem(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"revision", "event", "data", "created_at"})
+		rows.AddRow(1, "created", []byte(`{"id":"`+id.String()+`","name":"name","description":"","employee_count":3,"is_registered":true,"type":"Corporations"}`), time.Now())
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision, event, data, created_at FROM company_revisions WHERE company_id = $1 AND revision = $2`)).
+			WithArgs(id, 1).WillReturnRows(rows)
+		updatedRows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		updatedRows.AddRow(id.String(), "name", "", 3, true, "Corporations")
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE companies 
+	SET
+		name=COALESCE($2, name), 
+		description=COALESCE($3, description), 
+		employee_count=COALESCE($4, employee_count), 
+		is_registered=COALESCE($5, is_registered), 
+		legal_type=COALESCE($6, legal_type),
+		name_key=COALESCE($7, name_key)
+	WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id, "name", "", 3, true, "Corporations", "name").WillReturnRows(updatedRows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", models.EventNotifications{ID: id, Event: models.EventTypeUpdated}).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"revision":1}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9081/api/v1/company/"+id.String()+"/rollback", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("error_not_found", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT revision, event, data, created_at FROM company_revisions WHERE company_id = $1 AND revision = $2`)).
+			WithArgs(id, 7).WillReturnError(sql.ErrNoRows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"revision":7}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9082/api/v1/company/"+id.String()+"/rollback", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, `{"error":"Item not found"}`, string(respBody))
+	})
+}
+
+func TestListAuditRecords(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		createdAt := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"id", "created_at", "method", "route", "company_id", "principal", "status", "client_ip", "request_id"})
+		rows.AddRow(1, createdAt, "GET", "/api/v1/company/:id", id.String(), "alice", 200, "127.0.0.1", "req-1")
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, created_at, method, route, company_id, principal, status, client_ip, request_id FROM audit_log WHERE principal = $1 ORDER BY id DESC LIMIT $2`)).
+			WithArgs("alice", 100).WillReturnRows(rows)
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+			WithArgs("GET", "/api/v1/audit", "", "bob", 200, "127.0.0.1", "req-2").WillReturnResult(sqlmock.NewResult(2, 1))
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.GenerateWithSubject("bob", []string{"auditor"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithAudit(dbConn))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/audit?principal=alice", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("X-Request-ID", "req-2")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "req-2", resp.Header.Get("X-Request-ID"))
+		assert.Equal(t, `[{"id":1,"created_at":"2024-09-01T10:00:00Z","method":"GET","route":"/api/v1/company/:id","company_id":"`+id.String()+`","principal":"alice","status":200,"client_ip":"127.0.0.1","request_id":"req-1"}]`, string(respBody))
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_auth", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		auditMock := mocks.NewAuditInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithAudit(auditMock))
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/audit", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, `{"error":"Access denied"}`, string(respBody))
+	})
+}
+
+func TestReplaceItem(t *testing.T) {
+	t.Run("success_create", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"created"})
+		rows.AddRow(true)
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO companies (id, name, description, employee_count, is_registered, legal_type, name_key)`)).
+			WithArgs(id, "newcompany", "", 15, false, "Corporations", "newcompany").WillReturnRows(rows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", models.EventNotifications{ID: id, Event: models.EventTypeCreated}).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"name":"newcompany", "employee_count":15, "type":"Corporations"}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://localhost:9081/api/v1/company/"+id.String(), bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, `{"id":"`+id.String()+`","name":"newcompany","employee_count":15,"is_registered":false,"type":"Corporations"}`, string(respBody))
+	})
+
+	t.Run("success_replace", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE companies
+	SET name=$2, description=$3, employee_count=$4, is_registered=$5, legal_type=$6, name_key=$7
+	WHERE id = $1`)).
+			WithArgs(id, "newcompany", "", 15, false, "Corporations", "newcompany").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", models.EventNotifications{ID: id, Event: models.EventTypeUpdated}).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"name":"newcompany", "employee_count":15, "type":"Corporations"}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://localhost:9082/api/v1/company/"+id.String(), bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("If-Match", "*")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"id":"`+id.String()+`","name":"newcompany","employee_count":15,"is_registered":false,"type":"Corporations"}`, string(respBody))
+	})
+
+	t.Run("error_validation", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"employee_count":15, "type":"Corporations"}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://localhost:9083/api/v1/company/"+id.String(), bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, `{"error":"Invalid name"}`, string(respBody))
+	})
+}
+
+func TestPatchItem(t *testing.T) {
+	t.Run("success_merge_patch", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		rows.AddRow(id.String(), "name", "description", 3, true, "Corporations")
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1 FOR UPDATE`)).
+			WithArgs(id).WillReturnRows(rows)
+		updatedRows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		updatedRows.AddRow(id.String(), "name", "", 10, true, "Corporations")
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE companies 
+	SET
+		name=COALESCE($2, name), 
+		description=COALESCE($3, description), 
+		employee_count=COALESCE($4, employee_count), 
+		is_registered=COALESCE($5, is_registered), 
+		legal_type=COALESCE($6, legal_type),
+		name_key=COALESCE($7, name_key)
+	WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id, "name", "", 10, true, "Corporations", "name").WillReturnRows(updatedRows)
+		mock.ExpectCommit()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", models.EventNotifications{ID: id, Event: models.EventTypeUpdated}).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"description":null, "employee_count":10}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, "http://localhost:9081/api/v1/company/"+id.String(), bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "application/merge-patch+json")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_json_patch_test_failed", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		rows.AddRow(id.String(), "name", "description", 3, true, "Corporations")
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1 FOR UPDATE`)).
+			WithArgs(id).WillReturnRows(rows)
+		mock.ExpectRollback()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`[{"op":"test", "path":"/employee_count", "value":4}, {"op":"replace", "path":"/employee_count", "value":5}]`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, "http://localhost:9082/api/v1/company/"+id.String(), bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "application/json-patch+json")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, `{"error":"Patch test failed"}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_content_type", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`name=test`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, "http://localhost:9083/api/v1/company/"+id.String(), bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+		assert.Equal(t, `{"error":"Unsupported content type"}`, string(respBody))
+	})
+}
+
+func TestBatchItems(t *testing.T) {
+	t.Run("success_atomic", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		id2 := uuid.MustParse("a5e8e1e4-2c2a-4d57-9d1d-56c5a1f1f9a1")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectBegin()
+		rows := sqlmock.NewRows([]string{"id"})
+		rows.AddRow(id.String())
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO companies (id, name, description, employee_count, is_registered, legal_type, name_key) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING RETURNING id`)).
+			WithArgs(sqlmock.AnyArg(), "newcompany", "", 15, false, "Corporations", "newcompany").WillReturnRows(rows)
+		deletedRows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		deletedRows.AddRow(id2.String(), "oldcompany", "", 3, true, "NonProfit")
+		mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM companies WHERE id = $1`)).
+			WithArgs(id2).WillReturnRows(deletedRows)
+		mock.ExpectCommit()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", models.EventNotifications{ID: id, Event: models.EventTypeCreated}).Return(nil)
+		kafkaMock.On("Send", models.EventNotifications{ID: id2, Event: models.EventTypeDeleted}).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"atomic":true, "operations":[
+			{"op":"create", "data":{"name":"newcompany", "employee_count":15, "type":"Corporations"}},
+			{"op":"delete", "id":"` + id2.String() + `"}
+		]}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9081/api/v1/company:batch", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		assert.Equal(t, `{"results":[`+
+			`{"index":0,"op":"create","id":"`+id.String()+`","status":201,"item":{"id":"`+id.String()+`","name":"newcompany","employee_count":15,"is_registered":false,"type":"Corporations"}},`+
+			`{"index":1,"op":"delete","id":"`+id2.String()+`","status":200,"item":{"id":"`+id2.String()+`","name":"oldcompany","employee_count":3,"is_registered":true,"type":"NonProfit"}}`+
+			`]}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_atomic_validation", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"atomic":true, "operations":[
+			{"op":"create", "data":{"name":"newcompany", "employee_count":15, "type":"Corporations"}},
+			{"op":"update", "data":{"type":"LTD"}}
+		]}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9082/api/v1/company:batch", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+		assert.Equal(t, `{"results":[{"index":0,"op":"create","status":424,"error":"Batch aborted"},{"index":1,"op":"update","status":400,"error":"Invalid id"}]}`, string(respBody))
+	})
+}
+
+func TestGetItems(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		id2 := uuid.MustParse("a5e8e1e4-2c2a-4d57-9d1d-56c5a1f1f9a1")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		rows.AddRow(id.String(), "name", "description", 3, true, "Corporations")
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = ANY($1)`)).
+			WithArgs(pq.Array([]string{id.String(), id2.String()})).WillReturnRows(rows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/company?ids="+id.String()+","+id2.String(), http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"items":[{"id":"`+id.String()+`","name":"name","description":"description","employee_count":3,"is_registered":true,"type":"Corporations"}],"missing":["`+id2.String()+`"]}`, string(respBody))
+	})
+
+	t.Run("error_validation", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/company?ids=123", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, `{"error":"Invalid id"}`, string(respBody))
+	})
+
+	t.Run("success_batch_get", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		id2 := uuid.MustParse("a5e8e1e4-2c2a-4d57-9d1d-56c5a1f1f9a1")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("GetItems", mock.Anything, []uuid.UUID{id, id2}).Return([]models.ItemResponse{{ID: id, Name: "name", EmployeeCount: 3, Type: "Corporations"}}, nil)
+		auditMock := mocks.NewAuditInt(t)
+		auditMock.On("AddAuditRecords", mock.Anything, mock.MatchedBy(func(list []models.AuditRecord) bool {
+			return len(list) == 2 && list[0].CompanyID == id.String() && list[1].CompanyID == id2.String() &&
+				list[0].Route == "/api/v1/company:batchGet" && list[0].RequestID == list[1].RequestID
+		})).Return(nil)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithAudit(auditMock))
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"ids":["` + id.String() + `","` + id2.String() + `","` + id.String() + `"]}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9083/api/v1/company:batchGet", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"items":[{"id":"`+id.String()+`","name":"name","employee_count":3,"is_registered":false,"type":"Corporations"}],"missing":["`+id2.String()+`"]}`, string(respBody))
+	})
+
+	t.Run("success_over_batch_limit", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		ids := make([]uuid.UUID, 200)
+		list := make([]string, len(ids))
+		for n := range ids {
+			ids[n] = uuid.New()
+			list[n] = `"` + ids[n].String() + `"`
+		}
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("GetItems", mock.Anything, ids).Return([]models.ItemResponse{}, nil)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithBatchLimit(100))
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"ids":[` + strings.Join(list, ",") + `]}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9082/api/v1/company:batchGet", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"items":[],"missing":[`+strings.Join(list, ",")+`]}`, string(respBody))
+	})
+
+	t.Run("error_batch_get_limit", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		id2 := uuid.MustParse("a5e8e1e4-2c2a-4d57-9d1d-56c5a1f1f9a1")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithBatchGetLimit(1))
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9083/api/v1/company?ids="+id.String()+","+id2.String(), http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, `{"error":"Too many operations in batch"}`, string(respBody))
+	})
+
+	t.Run("error_unknown_action", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9081/api/v1/companyXYZ", http.NoBody)
+		assert.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, `{"error":"Item not found"}`, string(respBody))
+	})
+}
+
+func TestExportItems(t *testing.T) {
+	t.Run("success_csv", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`DECLARE export_cursor NO SCROLL CURSOR FOR
+	SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE legal_type = $1 AND is_registered = $2 ORDER BY id`)).
+			WithArgs("Corporations", true).WillReturnResult(sqlmock.NewResult(0, 0))
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		rows.AddRow(id.String(), "name", "some, text", 3, true, "Corporations")
+		mock.ExpectQuery(regexp.QuoteMeta(`FETCH 500 FROM export_cursor`)).WillReturnRows(rows)
+		mock.ExpectRollback()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/company/export?type=Corporations&is_registered=true", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Accept", "text/csv")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "id,name,description,employee_count,is_registered,type\n"+id.String()+`,name,"some, text",3,true,Corporations`+"\n", string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_not_acceptable", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/company/export", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Accept", "application/xml")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+		assert.Equal(t, `{"error":"Requested format is not supported"}`, string(respBody))
+	})
+}
+
+func TestImportItems(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		jobID := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		reqBody := []byte("name,employee_count,is_registered,type\nname,3,true,Corporations\n")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"id"})
+		rows.AddRow(jobID.String())
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO import_jobs (status, format, payload) VALUES ($1, $2, $3) RETURNING id`)).
+			WithArgs("pending", "csv", reqBody).WillReturnRows(rows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server, importer worker is not started
+		imp := importer.New(&log, dbConn, dbConn, kafkaMock)
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithImporter(imp))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9081/api/v1/company/import", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "text/csv")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "/api/v1/jobs/"+jobID.String(), resp.Header.Get("Location"))
+		assert.Equal(t, `{"id":"`+jobID.String()+`","status":"pending"}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_content_type", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		reqBody := []byte(`{"name":"name"}`)
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		importerMock := mocks.NewImporterInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithImporter(importerMock))
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9082/api/v1/company/import", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+		assert.Equal(t, `{"error":"Unsupported content type"}`, string(respBody))
+	})
+}
+
+func TestGetJob(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		jobID := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		createdAt := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+		updatedAt := time.Date(2024, 9, 1, 10, 0, 5, 0, time.UTC)
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"id", "status", "format", "total_rows", "processed_rows", "created_rows", "failed_rows", "error", "created_at", "updated_at"})
+		rows.AddRow(jobID.String(), "done", "csv", 3, 3, 2, 1, "", createdAt, updatedAt)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, status, format, total_rows, processed_rows, created_rows, failed_rows, error, created_at, updated_at
+	FROM import_jobs WHERE id = $1`)).WithArgs(jobID.String()).WillReturnRows(rows)
+		errRows := sqlmock.NewRows([]string{"row_num", "error"})
+		errRows.AddRow(2, "Invalid name")
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT row_num, error FROM import_job_errors WHERE job_id = $1 ORDER BY row_num`)).
+			WithArgs(jobID.String()).WillReturnRows(errRows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		imp := importer.New(&log, dbConn, dbConn, kafkaMock)
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithImporter(imp))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/jobs/"+jobID.String(), http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `{"id":"`+jobID.String()+`","status":"done","format":"csv","total_rows":3,"processed_rows":3,"created_rows":2,"failed_rows":1,"errors":[{"row":2,"error":"Invalid name"}],"created_at":"2024-09-01T10:00:00Z","updated_at":"2024-09-01T10:00:05Z"}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_not_found", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		jobID := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		importerMock := mocks.NewImporterInt(t)
+		importerMock.On("GetJob", mock.Anything, jobID).Return(nil, models.ErrNotFound)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithImporter(importerMock))
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/jobs/"+jobID.String(), http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, `{"error":"Item not found"}`, string(respBody))
+	})
+}
+
+func TestImportJob(t *testing.T) {
+	t.Run("success_replayed_rows", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		jobID := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		job := &models.ImportJob{
+			ID:      jobID,
+			Status:  models.JobStatusRunning,
+			Format:  models.ImportFormatNDJSON,
+			Payload: []byte(`{"name":"first","employee_count":3,"is_registered":true,"type":"Corporations"}` + "\n" + `{"name":"second","employee_count":5,"is_registered":false,"type":"NonProfit"}` + "\n"),
+			Epoch:   2,
+		}
+		id1 := uuid.NewSHA1(jobID, []byte("1"))
+		id2 := uuid.NewSHA1(jobID, []byte("2"))
+
+		// mock db, the first row was created before the job was taken over
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("CreateItemWithID", mock.Anything, id1, mock.Anything).Return(false, nil)
+		dbConn.On("CreateItemWithID", mock.Anything, id2, mock.Anything).Return(true, nil)
+		jobsMock := mocks.NewJobStorageInt(t)
+		jobsMock.On("ClaimImportJob", mock.Anything, mock.Anything).Return(job, nil).Once()
+		jobsMock.On("ClaimImportJob", mock.Anything, mock.Anything).Return(nil, models.ErrNotFound)
+		jobsMock.On("SaveImportProgress", mock.Anything, mock.MatchedBy(func(j *models.ImportJob) bool {
+			return j.Status == models.JobStatusDone && j.ProcessedRows == 2 && j.CreatedRows == 2 && j.FailedRows == 0 && j.Epoch == 2
+		}), []models.ImportRowError(nil)).Return(nil)
+
+		// mock kafka, only the new row is notified
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", models.EventNotifications{ID: id2, Event: models.EventTypeCreated}).Return(nil)
+
+		// start worker
+		imp := importer.New(&log, dbConn, jobsMock, kafkaMock)
+		imp.Start()
+		time.Sleep(50 * time.Millisecond)
+		imp.Close()
+	})
+
+	t.Run("error_lease_lost", func(t *testing.T) {
+		ctx := context.Background()
+		jobID := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		job := &models.ImportJob{ID: jobID, Status: models.JobStatusDone, TotalRows: 2, ProcessedRows: 2, CreatedRows: 2, Epoch: 1}
+
+		// mock db, the job was claimed again by another worker
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`, payload = '' WHERE id = $1 AND epoch = $8`)).
+			WithArgs(jobID.String(), models.JobStatusDone, 2, 2, 2, 0, "", 1).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		// make request
+		err = dbConn.SaveImportProgress(ctx, job, nil)
+
+		// test result
+		assert.Equal(t, models.ErrLeaseLost, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestItemStats(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectBegin()
+		rows := sqlmock.NewRows([]string{"count", "registered", "sum", "avg", "min", "max", "p50", "p90", "p99"})
+		rows.AddRow(3, 2, 160, 53.5, 5, 120, 35.0, 103.0, 118.3)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*), count(*) FILTER (WHERE is_registered),`)).
+			WithArgs(true).WillReturnRows(rows)
+		typeRows := sqlmock.NewRows([]string{"legal_type", "count"})
+		typeRows.AddRow("Corporations", 2)
+		typeRows.AddRow("NonProfit", 1)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT legal_type, count(*) FROM companies WHERE is_registered = $1 GROUP BY legal_type`)).
+			WithArgs(true).WillReturnRows(typeRows)
+		bucketRows := sqlmock.NewRows([]string{"bucket", "count"})
+		bucketRows.AddRow(0, 1)
+		bucketRows.AddRow(2, 2)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT width_bucket(employee_count, $2::int[]) AS bucket, count(*)
+	FROM companies WHERE is_registered = $1 GROUP BY bucket`)).
+			WithArgs(true, sqlmock.AnyArg()).WillReturnRows(bucketRows)
+		mock.ExpectRollback()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithStatsTTL(time.Minute))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/company/stats?is_registered=true&buckets=100,10", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "max-age=60", resp.Header.Get("Cache-Control"))
+		assert.Equal(t, `{"total":3,"by_type":{"Cooperative":0,"Corporations":2,"NonProfit":1,"Sole Proprietorship":0},`+
+			`"by_registration":{"registered":2,"unregistered":1},`+
+			`"employee_count":{"sum":160,"avg":53.5,"min":5,"max":120,"p50":35,"p90":103,"p99":118.3},`+
+			`"histogram":[{"to":10,"count":1},{"from":10,"to":100,"count":0},{"from":100,"count":2}]}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("success_cached", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("ItemStats", mock.Anything, &models.ItemFilter{Type: "NonProfit"}, []int{10, 50, 100, 500, 1000}).
+			Return(&models.ItemStats{Total: 1}, nil).Once()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request twice, the second one is served from cache
+		for n := 0; n < 2; n++ {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/company/stats?type=NonProfit", http.NoBody)
+			assert.NoError(t, err)
+			req.Header.Add("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			respBody, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			_ = resp.Body.Close()
+
+			// test result
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Contains(t, string(respBody), `"total":1`)
+		}
+	})
+
+	t.Run("error_validation", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9083/api/v1/company/stats?buckets=10,abc", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, `{"error":"Invalid filter"}`, string(respBody))
+	})
+}
+
+func TestStreamEvents(t *testing.T) {
+	t.Run("success_resume", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		created := models.EventNotifications{ID: id, Event: models.EventTypeCreated, Timestamp: 1}
+		updated := models.EventNotifications{ID: id, Event: models.EventTypeUpdated, Timestamp: 2}
+		kafkaMock.On("Send", created).Return(nil)
+		kafkaMock.On("Send", updated).Return(nil)
+		broker := events.New(kafkaMock, 10)
+		assert.NoError(t, broker.Send(created))
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, broker, api.WithEvents(broker))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request, unknown event ID results in reset and replay of the whole log
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/company/events", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Last-Event-ID", "stale-1")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		// live event after backlog
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, broker.Send(updated))
+
+		r := bufio.NewReader(resp.Body)
+		var blocks []string
+		for len(blocks) < 3 {
+			block, err := readEventBlock(r)
+			assert.NoError(t, err)
+			if err != nil {
+				break
+			}
+			blocks = append(blocks, block)
+		}
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "event: reset\ndata: {}\n", blocks[0])
+		assert.Regexp(t, `^id: \w+-1\nevent: created\ndata: \{"id":"`+id.String()+`","event":"created","timestamp":1\}\n$`, blocks[1])
+		assert.Regexp(t, `^id: \w+-2\nevent: updated\ndata: \{"id":"`+id.String()+`","event":"updated","timestamp":2\}\n$`, blocks[2])
+	})
+
+	t.Run("error_auth", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		eventsMock := mocks.NewEventStreamInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithEvents(eventsMock))
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/company/events", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, `{"error":"Access denied"}`, string(respBody))
+	})
+}
+
+// readEventBlock reads one server-sent event up to the empty line
+func readEventBlock(r *bufio.Reader) (string, error) {
+	var block string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return block, err
+		}
+		if line == "\n" {
+			return block, nil
+		}
+		block += line
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		otherID := uuid.MustParse("0b8e1b1e-3c5f-4a57-a3c6-4f0d0d2f6a11")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("GetItem", mock.Anything, id).Return(&models.ItemResponse{
+			ID:            id,
+			Name:          "name",
+			EmployeeCount: 3,
+			IsRegistered:  true,
+			Type:          "Corporations",
+		}, nil).Twice()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		other := models.EventNotifications{ID: otherID, Event: models.EventTypeUpdated, Timestamp: 1}
+		updated := models.EventNotifications{ID: id, Event: models.EventTypeUpdated, Timestamp: 2}
+		kafkaMock.On("Send", other).Return(nil)
+		kafkaMock.On("Send", updated).Return(nil)
+		broker := events.New(kafkaMock, 10)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, broker, api.WithEvents(broker))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		header := http.Header{}
+		header.Add("Authorization", "Bearer "+token)
+		conn, resp, err := websocket.DefaultDialer.Dial("ws://localhost:9081/api/v1/company/ws", header)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+			_ = conn.Close()
+		}()
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		assert.NoError(t, conn.WriteJSON(models.WSRequest{Action: "subscribe", IDs: []uuid.UUID{id}}))
+		_, snapshot, err := conn.ReadMessage()
+		assert.NoError(t, err)
+
+		// events of other companies are not delivered
+		assert.NoError(t, broker.Send(other))
+		assert.NoError(t, broker.Send(updated))
+		_, event, err := conn.ReadMessage()
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		item := `{"id":"` + id.String() + `","name":"name","employee_count":3,"is_registered":true,"type":"Corporations"}`
+		assert.Equal(t, `{"type":"snapshot","id":"`+id.String()+`","item":`+item+`}`+"\n", string(snapshot))
+		assert.Equal(t, `{"type":"event","id":"`+id.String()+`","event":"updated","timestamp":2,"item":`+item+`}`+"\n", string(event))
+	})
+
+	t.Run("error_auth", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		eventsMock := mocks.NewEventStreamInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithEvents(eventsMock))
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		header := http.Header{}
+		header.Add("Authorization", "Bearer "+token)
+		_, resp, err := websocket.DefaultDialer.Dial("ws://localhost:9082/api/v1/company/ws", header)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		// test result
+		assert.Equal(t, websocket.ErrBadHandshake, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("success_subprotocol_token", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		broker := events.New(kafkaMock, 10)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, broker, api.WithEvents(broker), api.WithAllowedOrigins([]string{"https://app.example.com"}))
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request, like a browser which can't set Authorization header
+		dialer := websocket.Dialer{Subprotocols: []string{"bearer", token}}
+		header := http.Header{}
+		header.Add("Origin", "https://app.example.com")
+		conn, resp, err := dialer.Dial("ws://localhost:9083/api/v1/company/ws", header)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+			_ = conn.Close()
+		}()
+
+		// test result
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		assert.Equal(t, "bearer", conn.Subprotocol())
+	})
+
+	t.Run("error_origin", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		eventsMock := mocks.NewEventStreamInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithEvents(eventsMock), api.WithAllowedOrigins([]string{"https://app.example.com"}))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		dialer := websocket.Dialer{Subprotocols: []string{"bearer", token}}
+		header := http.Header{}
+		header.Add("Origin", "https://evil.example.com")
+		_, resp, err := dialer.Dial("ws://localhost:9081/api/v1/company/ws", header)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		// test result
+		assert.Equal(t, websocket.ErrBadHandshake, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("success_busy_hub", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("GetItem", mock.Anything, id).Return(&models.ItemResponse{ID: id, Name: "name", Type: "Corporations"}, nil)
+
+		// mock kafka
+		broker := events.New(nil, 10)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, broker, api.WithEvents(broker))
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		header := http.Header{}
+		header.Add("Authorization", "Bearer "+token)
+		conn, resp, err := websocket.DefaultDialer.Dial("ws://localhost:9082/api/v1/company/ws", header)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+			_ = conn.Close()
+		}()
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		assert.NoError(t, conn.WriteJSON(models.WSRequest{Action: "subscribe", IDs: []uuid.UUID{id}}))
+		_, _, err = conn.ReadMessage()
+		assert.NoError(t, err)
+
+		// more events of other companies than the hub buffer, they don't count against the connection
+		for n := 0; n < 1000; n++ {
+			assert.NoError(t, broker.Send(models.EventNotifications{ID: uuid.New(), Event: models.EventTypeUpdated, Timestamp: 1}))
+			if n%100 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		assert.NoError(t, broker.Send(models.EventNotifications{ID: id, Event: models.EventTypeUpdated, Timestamp: 2}))
+		_, event, err := conn.ReadMessage()
+
+		// test result
+		assert.NoError(t, err)
+		assert.Contains(t, string(event), `"event":"updated","timestamp":2`)
+	})
+}
+
+func TestListChanges(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		createdAt := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+		data := `{"id":"` + id.String() + `","name":"name","description":"","employee_count":3,"is_registered":true,"type":"Corporations"}`
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"seq", "company_id", "revision", "event", "data", "created_at"})
+		rows.AddRow(11, id.String(), 1, "created", []byte(data), createdAt)
+		rows.AddRow(12, id.String(), 2, "deleted", []byte(data), createdAt)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT seq, company_id, revision, event, data, created_at FROM company_revisions WHERE seq > $1 ORDER BY seq LIMIT $2`)).
+			WithArgs(10, 2).WillReturnRows(rows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/company/changes?since=10&limit=2", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		item := `{"id":"` + id.String() + `","name":"name","employee_count":3,"is_registered":true,"type":"Corporations"}`
+		assert.Equal(t, `{"changes":[`+
+			`{"seq":11,"id":"`+id.String()+`","revision":1,"event":"created","item":`+item+`,"created_at":"2024-09-01T10:00:00Z"},`+
+			`{"seq":12,"id":"`+id.String()+`","revision":2,"event":"deleted","item":`+item+`,"created_at":"2024-09-01T10:00:00Z"}`+
+			`],"next":12}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_validation", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/company/changes?since=-1", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, `{"error":"Invalid filter"}`, string(respBody))
+	})
+}
+
+func TestCreateWebhook(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		createdAt := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+		reqBody := []byte(`{"url":"https://example.com/hook","events":["created","deleted"],"secret":"0123456789abcdef"}`)
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		rows := sqlmock.NewRows([]string{"id", "url", "events", "secret", "enabled", "failures", "created_at", "updated_at"})
+		rows.AddRow(id.String(), "https://example.com/hook", "{created,deleted}", "0123456789abcdef", true, 0, createdAt, createdAt)
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO webhooks (url, events, secret, enabled) VALUES ($1, $2, $3, $4)`)).
+			WithArgs("https://example.com/hook", sqlmock.AnyArg(), "0123456789abcdef", true).WillReturnRows(rows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithWebhooks(dbConn))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9081/api/v1/webhooks", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result, secret is not returned
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, `{"id":"`+id.String()+`","url":"https://example.com/hook","events":["created","deleted"],"enabled":true,"failures":0,`+
+			`"created_at":"2024-09-01T10:00:00Z","updated_at":"2024-09-01T10:00:00Z"}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_validation", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		reqBody := []byte(`{"url":"https://example.com/hook","events":["renamed"],"secret":"0123456789abcdef"}`)
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		webhooksMock := mocks.NewWebhookStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithWebhooks(webhooksMock))
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9082/api/v1/webhooks", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, `{"error":"Invalid event type"}`, string(respBody))
+	})
+
+	t.Run("error_private_url", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		reqBody := []byte(`{"url":"http://169.254.169.254/latest/meta-data","secret":"0123456789abcdef"}`)
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		webhooksMock := mocks.NewWebhookStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithWebhooks(webhooksMock))
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9083/api/v1/webhooks", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, `{"error":"Invalid URL"}`, string(respBody))
+	})
+}
+
+func TestMemoryStorage(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", mock.Anything).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, memory.New(), jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		do := func(method, url, body string) (int, []byte) {
+			req, err := http.NewRequestWithContext(ctx, method, "http://localhost:9081"+url, bytes.NewBufferString(body))
+			assert.NoError(t, err)
+			req.Header.Add("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			respBody, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			return resp.StatusCode, respBody
+		}
+
+		// make request
+		status, body := do(http.MethodPost, "/api/v1/company", `{"name":"newcompany", "employee_count":15, "type":"Corporations"}`)
+		assert.Equal(t, http.StatusCreated, status)
+		var item models.ItemResponse
+		assert.NoError(t, json.Unmarshal(body, &item))
+
+		status, _ = do(http.MethodPost, "/api/v1/company", `{"name":"newcompany", "employee_count":1, "type":"NonProfit"}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+
+		status, _ = do(http.MethodPatch, "/api/v1/company/"+item.ID.String(), `{"employee_count":20}`)
+		assert.Equal(t, http.StatusOK, status)
+
+		// test result
+		status, body = do(http.MethodGet, "/api/v1/company/"+item.ID.String(), "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, `{"id":"`+item.ID.String()+`","name":"newcompany","employee_count":20,"is_registered":false,"type":"Corporations"}`, string(body))
+
+		var revisions []models.ItemRevision
+		status, body = do(http.MethodGet, "/api/v1/company/"+item.ID.String()+"/revisions", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.NoError(t, json.Unmarshal(body, &revisions))
+		assert.Len(t, revisions, 2)
+
+		status, _ = do(http.MethodDelete, "/api/v1/company/"+item.ID.String(), "")
+		assert.Equal(t, http.StatusOK, status)
+		status, body = do(http.MethodGet, "/api/v1/company/"+item.ID.String(), "")
+		assert.Equal(t, http.StatusNotFound, status)
+		assert.Equal(t, `{"error":"Item not found"}`, string(body))
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// sqlite db
+		dbConn, err := db.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+		assert.NoError(t, err)
+		defer dbConn.Close()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", mock.Anything).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		do := func(method, url, body string) (int, []byte) {
+			req, err := http.NewRequestWithContext(ctx, method, "http://localhost:9081"+url, bytes.NewBufferString(body))
+			assert.NoError(t, err)
+			req.Header.Add("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			respBody, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			return resp.StatusCode, respBody
+		}
+
+		// make request
+		status, body := do(http.MethodPost, "/api/v1/company", `{"name":"newcompany", "employee_count":15, "type":"Corporations"}`)
+		assert.Equal(t, http.StatusCreated, status)
+		var item models.ItemResponse
+		assert.NoError(t, json.Unmarshal(body, &item))
+
+		status, body = do(http.MethodPost, "/api/v1/company", `{"name":"NEWCOMPANY", "employee_count":1, "type":"NonProfit"}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, `{"error":"`+models.ErrDuplicateName.Error()+`","conflicting_id":"`+item.ID.String()+`"}`, string(body))
+
+		status, _ = do(http.MethodPatch, "/api/v1/company/"+item.ID.String(), `{"employee_count":20, "is_registered":true}`)
+		assert.Equal(t, http.StatusOK, status)
+
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		status, _ = do(http.MethodPut, "/api/v1/company/"+id.String(), `{"name":"othercompany", "employee_count":100, "type":"NonProfit"}`)
+		assert.Equal(t, http.StatusCreated, status)
+
+		// test result
+		status, body = do(http.MethodGet, "/api/v1/company/"+item.ID.String(), "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, `{"id":"`+item.ID.String()+`","name":"newcompany","employee_count":20,"is_registered":true,"type":"Corporations"}`, string(body))
+
+		var revisions []models.ItemRevision
+		status, body = do(http.MethodGet, "/api/v1/company/"+item.ID.String()+"/revisions", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.NoError(t, json.Unmarshal(body, &revisions))
+		assert.Len(t, revisions, 2)
+		assert.Equal(t, models.EventTypeUpdated, revisions[1].Event)
+		assert.Equal(t, 20, revisions[1].Item.EmployeeCount)
+		assert.True(t, revisions[1].Item.IsRegistered)
+
+		var changes models.ChangesResponse
+		status, body = do(http.MethodGet, "/api/v1/company/changes?since=1", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.NoError(t, json.Unmarshal(body, &changes))
+		assert.Len(t, changes.Changes, 2)
+		assert.Equal(t, int64(3), changes.Next)
+
+		var stats models.ItemStats
+		status, body = do(http.MethodGet, "/api/v1/company/stats?buckets=50", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.NoError(t, json.Unmarshal(body, &stats))
+		assert.Equal(t, 2, stats.Total)
+		assert.Equal(t, 1, stats.ByRegistration.Registered)
+		assert.Equal(t, int64(120), stats.EmployeeCount.Sum)
+		assert.Equal(t, 60.0, stats.EmployeeCount.P50)
+		assert.Equal(t, 1, stats.Histogram[0].Count)
+		assert.Equal(t, 1, stats.Histogram[1].Count)
+
+		status, body = do(http.MethodGet, "/api/v1/company/export?name=OTHER", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Contains(t, string(body), "othercompany")
+		assert.NotContains(t, string(body), "newcompany")
+
+		status, _ = do(http.MethodDelete, "/api/v1/company/"+item.ID.String(), "")
+		assert.Equal(t, http.StatusOK, status)
+		status, body = do(http.MethodGet, "/api/v1/company/"+item.ID.String(), "")
+		assert.Equal(t, http.StatusNotFound, status)
+		assert.Equal(t, `{"error":"Item not found"}`, string(body))
+	})
+}
+
+func TestReadReplicas(t *testing.T) {
+	t.Run("success_read_your_writes", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		query := regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`)
+
+		// mock db, the first read goes to replica, the write and the read after it go to primary
+		conn, primaryMock, err := sqlmock.New()
+		assert.NoError(t, err)
+		replicaConn, replicaMock, err := sqlmock.New()
+		assert.NoError(t, err)
+		dbConn := db.NewFromConn(conn, replicaConn)
+		defer dbConn.Close()
+		replicaMock.ExpectQuery(query).WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"}).
+				AddRow(id.String(), "name", "description", 3, true, "Corporations"))
+		primaryMock.ExpectQuery(regexp.QuoteMeta(`UPDATE companies`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"}).
+				AddRow(id.String(), "name", "description", 4, true, "Corporations"))
+		primaryMock.ExpectQuery(query).WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"}).
+				AddRow(id.String(), "name", "description", 4, true, "Corporations"))
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", mock.Anything).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader", "writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithReadYourWrites(5*time.Second))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		do := func(method, body string, cookies []*http.Cookie) (*http.Response, []byte) {
+			req, err := http.NewRequestWithContext(ctx, method, "http://localhost:9081/api/v1/company/"+id.String(), bytes.NewBufferString(body))
+			assert.NoError(t, err)
+			req.Header.Add("Authorization", "Bearer "+token)
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			respBody, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			return resp, respBody
+		}
+
+		// make request
+		resp, body := do(http.MethodGet, "", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), `"employee_count":3`)
+		assert.Empty(t, resp.Header.Get("X-Read-Primary-Until"))
+
+		resp, _ = do(http.MethodPatch, `{"employee_count":4}`, nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("X-Read-Primary-Until"))
+		cookies := resp.Cookies()
+		assert.Len(t, cookies, 1)
+
+		resp, body = do(http.MethodGet, "", cookies)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(body), `"employee_count":4`)
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+
+	t.Run("success_failover", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		query := regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`)
+
+		// mock db, failed replica is skipped until the next health check
+		conn, primaryMock, err := sqlmock.New()
+		assert.NoError(t, err)
+		replicaConn, replicaMock, err := sqlmock.New()
+		assert.NoError(t, err)
+		dbConn := db.NewFromConn(conn, replicaConn)
+		defer dbConn.Close()
+		replicaMock.ExpectQuery(query).WithArgs(id).WillReturnError(errors.New("connection refused"))
+		for range 2 {
+			primaryMock.ExpectQuery(query).WithArgs(id).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"}).
+					AddRow(id.String(), "name", "description", 3, true, "Corporations"))
+		}
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		for range 2 {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/company/"+id.String(), http.NoBody)
+			assert.NoError(t, err)
+			req.Header.Add("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			_ = resp.Body.Close()
+
+			// test result
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+
+	t.Run("error_write_no_deadline", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock, api.WithReadYourWrites(5*time.Second))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, "http://localhost:9081/api/v1/company/"+id.String(), bytes.NewBufferString(`{`))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+
+		// test result
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("X-Read-Primary-Until"))
+		assert.Empty(t, resp.Cookies())
+	})
+
+	t.Run("success_export_failover", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db, replica fails to start the transaction, so export runs on primary
+		conn, primaryMock, err := sqlmock.New()
+		assert.NoError(t, err)
+		replicaConn, replicaMock, err := sqlmock.New()
+		assert.NoError(t, err)
+		dbConn := db.NewFromConn(conn, replicaConn)
+		defer dbConn.Close()
+		replicaMock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+		primaryMock.ExpectBegin()
+		primaryMock.ExpectExec(regexp.QuoteMeta(`DECLARE export_cursor NO SCROLL CURSOR FOR`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		primaryMock.ExpectQuery(regexp.QuoteMeta(`FETCH 500 FROM export_cursor`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"}).
+				AddRow(id.String(), "name", "description", 3, true, "Corporations"))
+		primaryMock.ExpectRollback()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9082/api/v1/company/export", http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req.Header.Add("Accept", "text/csv")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(respBody), id.String()+",name,description,3,true,Corporations")
+		assert.NoError(t, primaryMock.ExpectationsWereMet())
+		assert.NoError(t, replicaMock.ExpectationsWereMet())
+	})
+}
+
+func TestDBTimeout(t *testing.T) {
+	t.Run("error_statement_timeout", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`)).
+			WithArgs(id).WillReturnError(&pq.Error{Code: "57014", Message: "canceling statement due to statement timeout"})
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/company/"+id.String(), http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+		assert.Equal(t, `{"error":"DB timeout"}`, string(respBody))
+	})
+
+	t.Run("error_deadline", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("SimilarItems", mock.Anything, "newcompany", mock.Anything, mock.Anything).Return(nil, nil)
+		dbConn.On("CreateItem", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: %w", models.ErrDBTimeout, context.DeadlineExceeded))
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"name":"newcompany", "employee_count":15, "type":"Corporations"}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9082/api/v1/company", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+		assert.Equal(t, `{"error":"DB timeout"}`, string(respBody))
+	})
+}
+
+func TestTransientRetry(t *testing.T) {
+	t.Run("success_read", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		query := regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`)
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectQuery(query).WithArgs(id).WillReturnError(&pq.Error{Code: "40001"})
+		rows := sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"})
+		rows.AddRow(id.String(), "name", "description", 3, true, "Corporations")
+		mock.ExpectQuery(query).WithArgs(id).WillReturnRows(rows)
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/api/v1/company/"+id.String(), http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("success_create_committed", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		query := regexp.QuoteMeta(`INSERT INTO companies (id, name, description, employee_count, is_registered, legal_type, name_key) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING RETURNING id`)
+
+		// mock db, the connection is lost after commit, so the retry finds the row with the same id
+		conn, dbMock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		var id string
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(regexp.QuoteMeta(`SELECT set_config('pg_trgm.similarity_threshold', $1, true)`)).
+			WithArgs("0.5").WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, similarity(name_key, $1) AS score FROM companies`)).
+			WithArgs("newcompany", 0.5, 5).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "score"}))
+		dbMock.ExpectRollback()
+		dbMock.ExpectQuery(query).WithArgs(idArg{&id}, "newcompany", "", 15, false, "Corporations", "newcompany").
+			WillReturnError(&pq.Error{Code: "08006"})
+		dbMock.ExpectQuery(query).WithArgs(idArg{&id}, "newcompany", "", 15, false, "Corporations", "newcompany").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", mock.Anything).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"name":"newcompany", "employee_count":15, "type":"Corporations"}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9082/api/v1/company", bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		var item models.ItemResponse
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&item))
+
+		// test result
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, id, item.ID.String())
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	t.Run("error_update_connection_lost", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db, the update may have been committed before the connection was lost, so it is not repeated
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectQuery(regexp.QuoteMeta(`UPDATE companies 
+	SET
+		name=COALESCE($2, name), 
+		description=COALESCE($3, description), 
+		employee_count=COALESCE($4, employee_count), 
+		is_registered=COALESCE($5, is_registered), 
+		legal_type=COALESCE($6, legal_type),
+		name_key=COALESCE($7, name_key)
+	WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`)).
+			WithArgs(id, nil, nil, 1, nil, nil, nil).WillReturnError(&pq.Error{Code: "08006"})
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := []byte(`{"employee_count":1}`)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, "http://localhost:9083/api/v1/company/"+id.String(), bytes.NewBuffer(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, `{"error":"DB unavailable"}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_unavailable", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		query := regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`)
+
+		// mock db
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		for range 3 {
+			mock.ExpectQuery(query).WithArgs(id).WillReturnError(&pq.Error{Code: "57P01"})
+		}
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"reader"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9083") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9083/api/v1/company/"+id.String(), http.NoBody)
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "5", resp.Header.Get("Retry-After"))
+		assert.Equal(t, `{"error":"DB unavailable"}`, string(respBody))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// idArg keeps the first matched argument and then matches only the same value
+type idArg struct {
+	v *string
+}
+
+func (a idArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if *a.v == "" {
+		*a.v = s
+	}
+	return ok && s == *a.v
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock cache
+		statsMock := mocks.NewCacheStatsInt(t)
+		statsMock.On("Stats").Return(models.CacheStats{Hits: 1, Misses: 2, Invalidations: 1, Size: 1})
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, mocks.NewStorageInt(t), jwtAuth, kafkaMock, api.WithCacheStats(statsMock))
+		go func() { _ = api.Run(":9081") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request, metrics are not authorized
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:9081/metrics", http.NoBody)
+		assert.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		metrics, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(metrics), "xmtask_cache_hits_total 1\n")
+		assert.Contains(t, string(metrics), "xmtask_cache_misses_total 2\n")
+		assert.Contains(t, string(metrics), "xmtask_cache_invalidations_total 1\n")
+		assert.Contains(t, string(metrics), "xmtask_cache_entries 1\n")
+	})
+}
+
+func TestWithTx(t *testing.T) {
+	t.Run("success_commit", func(t *testing.T) {
+		ctx := context.Background()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		query := regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`)
+
+		// mock db, both calls share one transaction
+		conn, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		mock.ExpectBegin()
+		mock.ExpectQuery(query).WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"}).
+				AddRow(id.String(), "name", "description", 3, true, "Corporations"))
+		mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM companies WHERE id = $1`)).WithArgs(id.String()).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "employee_count", "is_registered", "legal_type"}).
+				AddRow(id.String(), "name", "description", 3, true, "Corporations"))
+		mock.ExpectCommit()
+
+		// make request
+		err = dbConn.WithTx(ctx, func(tx models.StorageInt) error {
+			_, err := tx.GetItem(ctx, id)
+			if err != nil {
+				return err
+			}
+			_, err = tx.DeleteItem(ctx, id)
+			return err
+		})
+
+		// test result
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error_rollback", func(t *testing.T) {
+		ctx := context.Background()
+
+		// memory storage keeps nothing from failed transaction
+		stor := memory.New()
+		var id *uuid.UUID
+
+		// make request
+		err := stor.WithTx(ctx, func(tx models.StorageInt) error {
+			var err error
+			id, err = tx.CreateItem(ctx, &models.ItemCreateRequest{Name: "newcompany", EmployeeCount: 15, Type: "Corporations"})
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateItem(ctx, &models.ItemCreateRequest{Name: "newcompany", EmployeeCount: 16, Type: "Corporations"})
+			return err
+		})
+
+		// test result
+		assert.Equal(t, &models.DuplicateNameError{ID: *id}, err)
+		_, err = stor.GetItem(ctx, *id)
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+}
+
+func TestSimilarItems(t *testing.T) {
+	for _, storage := range []string{"memory", "sqlite"} {
+		t.Run("success_"+storage, func(t *testing.T) {
+			ctx := context.Background()
+			log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+			// storage
+			var stor models.StorageInt = memory.New()
+			if storage == "sqlite" {
+				dbConn, err := db.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+				assert.NoError(t, err)
+				defer dbConn.Close()
+				stor = dbConn
+			}
+
+			// mock kafka
+			kafkaMock := mocks.NewNotifyInt(t)
+			kafkaMock.On("Send", mock.Anything).Return(nil)
+
+			// real jwt
+			jwtAuth, err := auth.New(jwtKey)
+			assert.NoError(t, err)
+			token, err := jwtAuth.Generate([]string{"reader", "writer"})
+			assert.NoError(t, err)
+
+			// start server
+			api := api.New(&log, stor, jwtAuth, kafkaMock)
+			go func() { _ = api.Run(":9081") }()
+			time.Sleep(10 * time.Millisecond)
+			defer api.Close()
+
+			do := func(method, url, body string) (int, []byte) {
+				req, err := http.NewRequestWithContext(ctx, method, "http://localhost:9081"+url, bytes.NewBufferString(body))
+				assert.NoError(t, err)
+				req.Header.Add("Authorization", "Bearer "+token)
+				resp, err := http.DefaultClient.Do(req)
+				assert.NoError(t, err)
+				defer func() {
+					_ = resp.Body.Close()
+				}()
+				respBody, err := io.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				return resp.StatusCode, respBody
+			}
+
+			// make request
+			status, body := do(http.MethodPost, "/api/v1/company", `{"name":"Acme Trading", "employee_count":15, "type":"Corporations"}`)
+			assert.Equal(t, http.StatusCreated, status)
+			var first models.ItemCreateResponse
+			assert.NoError(t, json.Unmarshal(body, &first))
+			assert.Empty(t, first.Warnings)
+
+			status, body = do(http.MethodPost, "/api/v1/company", `{"name":"Acme Tradin", "employee_count":15, "type":"Corporations"}`)
+			assert.Equal(t, http.StatusCreated, status)
+			var second models.ItemCreateResponse
+			assert.NoError(t, json.Unmarshal(body, &second))
+
+			status, body = do(http.MethodPost, "/api/v1/company?strict=true", `{"name":"acme tradng", "employee_count":15, "type":"Corporations"}`)
+			assert.Equal(t, http.StatusConflict, status)
+			var conflict models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(body, &conflict))
+
+			status, _ = do(http.MethodPost, "/api/v1/company?strict=maybe", `{"name":"Other", "employee_count":15, "type":"Corporations"}`)
+			assert.Equal(t, http.StatusBadRequest, status)
+
+			status, body = do(http.MethodGet, "/api/v1/company/similar?name=acme+trade&limit=1", "")
+			assert.Equal(t, http.StatusOK, status)
+			var similar models.SimilarItemsResponse
+			assert.NoError(t, json.Unmarshal(body, &similar))
+
+			status, _ = do(http.MethodGet, "/api/v1/company/similar?name=acme&threshold=2", "")
+			assert.Equal(t, http.StatusBadRequest, status)
+
+			// test result
+			if assert.Len(t, second.Warnings, 1) {
+				assert.Equal(t, first.ID, second.Warnings[0].ID)
+				assert.Equal(t, "Acme Trading", second.Warnings[0].Name)
+				assert.InDelta(t, 11.0/12, second.Warnings[0].Score, 0.001)
+			}
+			assert.Equal(t, models.ErrSimilarName.Error(), conflict.Error)
+			assert.Len(t, conflict.Matches, 2)
+			if assert.Len(t, similar.Items, 1) {
+				assert.Equal(t, second.ID, similar.Items[0].ID)
+			}
+		})
+	}
+}
+
+func TestMergeItem(t *testing.T) {
+	for _, storage := range []string{"memory", "sqlite"} {
+		t.Run("success_"+storage, func(t *testing.T) {
+			ctx := context.Background()
+			log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+			// storage
+			var stor models.StorageInt = memory.New()
+			if storage == "sqlite" {
+				dbConn, err := db.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+				assert.NoError(t, err)
+				defer dbConn.Close()
+				stor = dbConn
+			}
+
+			// mock kafka
+			kafkaMock := mocks.NewNotifyInt(t)
+			kafkaMock.On("Send", mock.Anything).Return(nil)
+
+			// real jwt
+			jwtAuth, err := auth.New(jwtKey)
+			assert.NoError(t, err)
+			token, err := jwtAuth.Generate([]string{"reader", "writer"})
+			assert.NoError(t, err)
+
+			// start server
+			api := api.New(&log, stor, jwtAuth, kafkaMock)
+			go func() { _ = api.Run(":9081") }()
+			time.Sleep(10 * time.Millisecond)
+			defer api.Close()
+
+			client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+			do := func(method, url, body string) (*http.Response, []byte) {
+				req, err := http.NewRequestWithContext(ctx, method, "http://localhost:9081"+url, bytes.NewBufferString(body))
+				assert.NoError(t, err)
+				req.Header.Add("Authorization", "Bearer "+token)
+				resp, err := client.Do(req)
+				assert.NoError(t, err)
+				defer func() {
+					_ = resp.Body.Close()
+				}()
+				respBody, err := io.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				return resp, respBody
+			}
+			create := func(body string) uuid.UUID {
+				resp, respBody := do(http.MethodPost, "/api/v1/company", body)
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+				var item models.ItemResponse
+				assert.NoError(t, json.Unmarshal(respBody, &item))
+				return item.ID
+			}
+
+			// make request
+			target := create(`{"name":"Acme", "employee_count":10, "type":"Corporations"}`)
+			source := create(`{"name":"Acme Trading", "description":"wholesale", "employee_count":5, "is_registered":true, "type":"NonProfit"}`)
+			older := create(`{"name":"Acme Group", "employee_count":1, "type":"NonProfit"}`)
+
+			resp, _ := do(http.MethodPost, "/api/v1/company/"+source.String()+"/merge", `{"source_id":"`+older.String()+`"}`)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			resp, body := do(http.MethodPost, "/api/v1/company/"+target.String()+"/merge",
+				`{"source_id":"`+source.String()+`", "strategy":{"name":"source", "description":"longest", "employee_count":"sum", "is_registered":"any"}}`)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var merged models.ItemResponse
+			assert.NoError(t, json.Unmarshal(body, &merged))
+
+			respSelf, _ := do(http.MethodPost, "/api/v1/company/"+target.String()+"/merge", `{"source_id":"`+target.String()+`"}`)
+			respStrategy, _ := do(http.MethodPost, "/api/v1/company/"+target.String()+"/merge", `{"source_id":"`+older.String()+`", "strategy":{"type":"max"}}`)
+			respMissing, _ := do(http.MethodPost, "/api/v1/company/"+target.String()+"/merge", `{"source_id":"`+source.String()+`"}`)
+			big := create(`{"name":"Big", "employee_count":2147483647, "type":"Corporations"}`)
+			respOverflow, _ := do(http.MethodPost, "/api/v1/company/"+target.String()+"/merge",
+				`{"source_id":"`+big.String()+`", "strategy":{"employee_count":"sum"}}`)
+
+			// test result
+			assert.Equal(t, target, merged.ID)
+			assert.Equal(t, "Acme Trading", merged.Name)
+			assert.Equal(t, "wholesale", merged.Description)
+			assert.Equal(t, 15, merged.EmployeeCount)
+			assert.True(t, merged.IsRegistered)
+			assert.Equal(t, "Corporations", merged.Type)
+			kafkaMock.AssertCalled(t, "Send", models.EventNotifications{ID: target, Event: models.EventTypeMerged, MergedFrom: &source})
+
+			assert.Equal(t, http.StatusBadRequest, respSelf.StatusCode)
+			assert.Equal(t, http.StatusBadRequest, respStrategy.StatusCode)
+			assert.Equal(t, http.StatusNotFound, respMissing.StatusCode)
+			assert.Equal(t, http.StatusBadRequest, respOverflow.StatusCode)
+			resp, _ = do(http.MethodGet, "/api/v1/company/"+big.String(), "")
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			resp, _ = do(http.MethodGet, "/api/v1/company/"+source.String(), "")
+			assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+			assert.Equal(t, "/api/v1/company/"+target.String(), resp.Header.Get("Location"))
+			// redirects to the source are moved to the survivor
+			resp, _ = do(http.MethodGet, "/api/v1/company/"+older.String(), "")
+			assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+			assert.Equal(t, "/api/v1/company/"+target.String(), resp.Header.Get("Location"))
+
+			resp, body = do(http.MethodGet, "/api/v1/company/"+target.String(), "")
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, `{"id":"`+target.String()+`","name":"Acme Trading","description":"wholesale","employee_count":15,"is_registered":true,"type":"Corporations"}`, string(body))
+		})
+	}
+
+	t.Run("success_lock_order", func(t *testing.T) {
+		ctx := context.Background()
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		target := uuid.MustParse("f1d3a6c2-7b4e-4f0a-9c8d-2e5b6a7c8d9e")
+		source := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		columns := []string{"id", "name", "description", "employee_count", "is_registered", "legal_type"}
+		lock := regexp.QuoteMeta(`SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1 FOR UPDATE`)
+
+		// mock db, both rows are locked in id order before the merge, merged fields are computed from locked rows
+		conn, dbMock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+		dbConn := db.NewFromConn(conn)
+		dbMock.ExpectBegin()
+		dbMock.ExpectQuery(lock).WithArgs(source.String()).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(source.String(), "source", "", 5, false, "Corporations"))
+		dbMock.ExpectQuery(lock).WithArgs(target.String()).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(target.String(), "target", "", 3, false, "Corporations"))
+		dbMock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM companies WHERE id = $1)`)).WithArgs(target.String()).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		dbMock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM companies WHERE id = $1`)).WithArgs(source.String()).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(source.String(), "source", "", 5, false, "Corporations"))
+		dbMock.ExpectExec(regexp.QuoteMeta(`UPDATE company_merges SET target_id = $2 WHERE target_id = $1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM company_merges WHERE source_id = $1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO company_merges (source_id, target_id, data) VALUES ($1, $2, $3)`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectQuery(regexp.QuoteMeta(`UPDATE companies`)).
+			WithArgs(target.String(), "target", "", 8, false, "Corporations", "target").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(target.String(), "target", "", 8, false, "Corporations"))
+		dbMock.ExpectCommit()
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", mock.Anything).Return(nil)
+
+		// real jwt
+		jwtAuth, err := auth.New(jwtKey)
+		assert.NoError(t, err)
+		token, err := jwtAuth.Generate([]string{"writer"})
+		assert.NoError(t, err)
+
+		// start server
+		api := api.New(&log, dbConn, jwtAuth, kafkaMock)
+		go func() { _ = api.Run(":9082") }()
+		time.Sleep(10 * time.Millisecond)
+		defer api.Close()
+
+		// make request
+		reqBody := `{"source_id":"` + source.String() + `", "strategy":{"employee_count":"sum"}}`
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:9082/api/v1/company/"+target.String()+"/merge", bytes.NewBufferString(reqBody))
+		assert.NoError(t, err)
+		req.Header.Add("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		respBody, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, string(respBody), `"employee_count":8`)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
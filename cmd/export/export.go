@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"os"
+
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/rs/zerolog"
+
+	"github.com/mannulus-immortalis/xmtask/internal/api/auth"
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+var formats = map[string]string{
+	"csv":    "text/csv",
+	"ndjson": "application/x-ndjson",
+}
+
+func main() {
+	log := zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+	jwtKey := os.Getenv("JWT_KEY")
+	if jwtKey == "" {
+		log.Fatal().Msg("JWT_KEY env value is empty, see user manual for configuration description")
+	}
+
+	apiURL := flag.String("url", "http://localhost:8080", "API base URL")
+	format := flag.String("format", "csv", "export format: csv or ndjson")
+	filter := flag.String("filter", "", "filter query string, example: \"type=NonProfit&is_registered=true\"")
+	output := flag.String("o", "", "output file, stdout by default")
+	flag.Parse()
+
+	accept, ok := formats[*format]
+	if !ok {
+		log.Fatal().Str("Format", *format).Msg("unsupported format")
+	}
+
+	a, err := auth.New(jwtKey)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid HS256 key")
+	}
+	token, err := a.GenerateWithSubject("export", []string{models.RoleReader})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Token generation failed")
+	}
+
+	url := *apiURL + "/api/v1/company/export"
+	if *filter != "" {
+		url += "?" + *filter
+	}
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid request")
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("Accept", accept)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatal().Err(err).Msg("export request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		log.Fatal().Int("Status", resp.StatusCode).Str("Response", string(body)).Msg("export request failed")
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			log.Fatal().Err(err).Msg("output file create failed")
+		}
+		defer out.Close()
+	}
+
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
+		log.Fatal().Err(err).Msg("export is incomplete")
+	}
+	log.Info().Int64("Bytes", n).Str("Format", *format).Msg("export is done")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"os"
 
 	_ "github.com/joho/godotenv/autoload"
@@ -17,17 +18,20 @@ func main() {
 		log.Fatal().Msg("JWT_KEY env value is empty, see user manual for configuration description")
 	}
 
-	if len(os.Args) < 2 {
+	subject := flag.String("sub", "", "token subject (principal name)")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		log.Fatal().Msg("missing command line parameter [role]")
 	}
-	roles := os.Args[1:]
+	roles := flag.Args()
 	a, err := auth.New(jwtKey)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Invalid HS256 key")
 	}
-	token, err := a.Generate(roles)
+	token, err := a.GenerateWithSubject(*subject, roles)
 	if err != nil {
 		log.Fatal().Err(err).Str("key", jwtKey).Msg("Token generation failed")
 	}
-	log.Info().Interface("Roles", roles).Str("JWT", token).Msg("JWT is genereated")
+	log.Info().Str("Subject", *subject).Interface("Roles", roles).Str("JWT", token).Msg("JWT is genereated")
 }
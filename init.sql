@@ -1,8 +1,160 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 CREATE TABLE companies (
   id uuid PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
-  name text NOT NULL UNIQUE,
+  name text NOT NULL,
   description text NOT NULL, 
   employee_count int NOT NULL, 
   is_registered bool NOT NULL, 
-  legal_type text NOT NULL
+  legal_type text NOT NULL,
+  -- normalized name computed by the service, NULL keys are filled on start,
+  -- see migrations/0001_name_key.sql for existing databases
+  name_key text
 );
+CREATE UNIQUE INDEX companies_name_key_uniq ON companies (name_key);
+-- trigram index for similar names search
+CREATE INDEX companies_name_key_trgm ON companies USING gin (name_key gin_trgm_ops);
+
+-- merged companies are moved here, lookups of source_id are redirected to target_id,
+-- see migrations/0003_company_merges.sql for existing databases
+CREATE TABLE company_merges (
+  source_id uuid PRIMARY KEY NOT NULL,
+  target_id uuid NOT NULL,
+  data jsonb NOT NULL,
+  merged_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX company_merges_target_id ON company_merges (target_id);
+
+CREATE TABLE company_revisions (
+  company_id uuid NOT NULL,
+  revision int NOT NULL,
+  event text NOT NULL,
+  data jsonb NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  seq bigint NOT NULL UNIQUE,
+  PRIMARY KEY (company_id, revision)
+);
+
+CREATE FUNCTION record_company_revision() RETURNS trigger AS $$
+DECLARE
+  rec companies;
+  ev text;
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    rec := NEW;
+    ev := 'created';
+  ELSIF TG_OP = 'UPDATE' THEN
+    -- only recorded columns are compared, so name keys recomputed by the service are not a change
+    IF (OLD.name, OLD.description, OLD.employee_count, OLD.is_registered, OLD.legal_type) IS NOT DISTINCT FROM
+      (NEW.name, NEW.description, NEW.employee_count, NEW.is_registered, NEW.legal_type) THEN
+      RETURN NULL;
+    END IF;
+    rec := NEW;
+    ev := 'updated';
+  ELSE
+    rec := OLD;
+    ev := 'deleted';
+  END IF;
+
+  -- global change sequence for the changes feed: the trigger is deferred to commit and writers are
+  -- serialized from here until commit, so sequence numbers become visible in order and without gaps;
+  -- the lock also protects revision numbers taken from the history of the company
+  PERFORM pg_advisory_xact_lock(hashtext('company_revisions_seq'));
+
+  INSERT INTO company_revisions (company_id, revision, event, data, seq)
+  SELECT rec.id, COALESCE(MAX(revision), 0) + 1, ev, jsonb_build_object(
+    'id', rec.id,
+    'name', rec.name,
+    'description', rec.description,
+    'employee_count', rec.employee_count,
+    'is_registered', rec.is_registered,
+    'type', rec.legal_type
+  ), (SELECT COALESCE(MAX(seq), 0) + 1 FROM company_revisions)
+  FROM company_revisions WHERE company_id = rec.id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- deferred, so the lock above is held only while the transaction commits
+CREATE CONSTRAINT TRIGGER companies_revisions
+AFTER INSERT OR UPDATE OR DELETE ON companies
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION record_company_revision();
+
+CREATE TABLE audit_log (
+  id bigserial PRIMARY KEY,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  method text NOT NULL,
+  route text NOT NULL,
+  company_id text NOT NULL,
+  principal text NOT NULL,
+  status int NOT NULL,
+  client_ip text NOT NULL,
+  request_id text NOT NULL
+);
+CREATE INDEX audit_log_company_id ON audit_log (company_id);
+CREATE INDEX audit_log_principal ON audit_log (principal);
+
+-- audit log is append-only
+CREATE FUNCTION reject_audit_log_change() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION reject_audit_log_change();
+
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_log_change();
+
+CREATE TABLE import_jobs (
+  id uuid PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+  status text NOT NULL,
+  format text NOT NULL,
+  payload bytea NOT NULL,
+  total_rows int NOT NULL DEFAULT 0,
+  processed_rows int NOT NULL DEFAULT 0,
+  created_rows int NOT NULL DEFAULT 0,
+  failed_rows int NOT NULL DEFAULT 0,
+  error text NOT NULL DEFAULT '',
+  -- incremented on every claim, saves of the worker which lost the lease are rejected
+  epoch int NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX import_jobs_status ON import_jobs (status, created_at);
+
+CREATE TABLE import_job_errors (
+  job_id uuid NOT NULL REFERENCES import_jobs (id),
+  row_num int NOT NULL,
+  error text NOT NULL,
+  PRIMARY KEY (job_id, row_num)
+);
+
+CREATE TABLE webhooks (
+  id uuid PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+  url text NOT NULL,
+  events text[] NOT NULL,
+  secret text NOT NULL,
+  enabled bool NOT NULL DEFAULT true,
+  failures int NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE webhook_deliveries (
+  id bigserial PRIMARY KEY,
+  webhook_id uuid NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+  company_id uuid NOT NULL,
+  event text NOT NULL,
+  attempt int NOT NULL,
+  status int NOT NULL,
+  error text NOT NULL,
+  duration_ms bigint NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
+CREATE INDEX webhook_deliveries_created_at ON webhook_deliveries (created_at);
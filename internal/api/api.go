@@ -1,32 +1,86 @@
 package api
 
 import (
+	"errors"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 
 	"github.com/mannulus-immortalis/xmtask/internal/models"
 )
 
 type api struct {
-	log    *zerolog.Logger
-	stor   models.StorageInt
-	auth   models.AuthInt
-	notify models.NotifyInt
-	r      *gin.Engine
-	srv    *http.Server
+	log      *zerolog.Logger
+	stor     models.StorageInt
+	auth     models.AuthInt
+	notify   models.NotifyInt
+	audit    models.AuditInt
+	importer models.ImporterInt
+	events   models.EventStreamInt
+	webhooks models.WebhookStorageInt
+	cache    models.CacheStatsInt
+	r        *gin.Engine
+	srv      *http.Server
+
+	allowedOrigins    []string
+	batchLimit        int
+	batchGetLimit     int
+	stats             statsCache
+	readPrimaryWindow time.Duration
+	similarity        similarity
+}
+
+type Option func(a *api)
+
+// WithAudit enables recording of every authorized request and the audit query endpoint
+func WithAudit(audit models.AuditInt) Option {
+	return func(a *api) {
+		a.audit = audit
+	}
+}
+
+// WithAllowedOrigins sets origins of browser pages allowed to call the API, for CORS and WebSocket handshake
+func WithAllowedOrigins(origins []string) Option {
+	return func(a *api) {
+		a.allowedOrigins = origins
+	}
 }
 
-func New(log *zerolog.Logger, stor models.StorageInt, auth models.AuthInt, notify models.NotifyInt) *api {
+const (
+	identityKey        = "identity"
+	requestIDKey       = "request_id"
+	auditCompanyIDsKey = "audit_company_ids"
+
+	headerRequestID = "X-Request-ID"
+	headerWarning   = "Warning"
+
+	// RFC 7234 miscellaneous warning
+	warningNotifyFailed = `199 - "Notification send failed"`
+
+	// seconds, failover of managed Postgres usually takes a few of them
+	retryAfterUnavailable = "5"
+)
+
+func New(log *zerolog.Logger, stor models.StorageInt, auth models.AuthInt, notify models.NotifyInt, opts ...Option) *api {
 	a := api{
 		log:    log,
 		stor:   stor,
 		auth:   auth,
 		notify: notify,
 		r:      gin.New(),
+
+		allowedOrigins: []string{"*"},
+		batchLimit:     defaultBatchLimit,
+		batchGetLimit:  defaultBatchGetLimit,
+		stats:          statsCache{ttl: defaultStatsTTL},
+		similarity:     similarity{threshold: defaultSimilarityThreshold, strict: defaultStrictThreshold},
+	}
+	for _, opt := range opts {
+		opt(&a)
 	}
 	a.SetupRoutes()
 	return &a
@@ -46,13 +100,52 @@ func (a *api) Close() {
 
 func (a *api) SetupRoutes() {
 	a.r.Use(gin.Recovery())
-	a.r.Use(corsMiddleware())
+	a.r.Use(corsMiddleware(a.allowedOrigins))
+	a.r.Use(requestIDMiddleware())
+	if a.readPrimaryWindow > 0 {
+		a.r.Use(a.readYourWritesMiddleware())
+	}
 	a.r.GET("/alive", a.Alive)
+	if a.cache != nil {
+		a.r.GET("/metrics", a.Metrics)
+	}
 
 	a.r.POST("/api/v1/company", a.RequireRole(models.RoleWriter), a.CreateItem)
+	// role depends on the action, CompanyAction checks it
+	a.r.POST("/api/v1/company:action", a.CompanyAction)
+	a.r.GET("/api/v1/company", a.RequireRole(models.RoleReader), a.GetItems)
 	a.r.PATCH("/api/v1/company/:id", a.RequireRole(models.RoleWriter), a.UpdateItem)
+	a.r.PUT("/api/v1/company/:id", a.RequireRole(models.RoleWriter), a.ReplaceItem)
 	a.r.DELETE("/api/v1/company/:id", a.RequireRole(models.RoleWriter), a.DeleteItem)
 	a.r.GET("/api/v1/company/:id", a.RequireRole(models.RoleReader), a.GetItem)
+	a.r.GET("/api/v1/company/export", a.RequireRole(models.RoleReader), a.ExportItems)
+	a.r.GET("/api/v1/company/stats", a.RequireRole(models.RoleReader), a.ItemStats)
+	a.r.GET("/api/v1/company/changes", a.RequireRole(models.RoleReader), a.ListChanges)
+	a.r.GET("/api/v1/company/similar", a.RequireRole(models.RoleReader), a.SimilarItems)
+	a.r.GET("/api/v1/company/:id/revisions", a.RequireRole(models.RoleReader), a.ListRevisions)
+	a.r.GET("/api/v1/company/:id/diff", a.RequireRole(models.RoleReader), a.DiffItem)
+	a.r.POST("/api/v1/company/:id/rollback", a.RequireRole(models.RoleWriter), a.RollbackItem)
+	a.r.POST("/api/v1/company/:id/merge", a.RequireRole(models.RoleWriter), a.MergeItem)
+
+	if a.events != nil {
+		a.r.GET("/api/v1/company/events", a.RequireRole(models.RoleReader), a.StreamEvents)
+		a.r.GET("/api/v1/company/ws", a.RequireRole(models.RoleReader), a.Subscribe)
+	}
+	if a.importer != nil {
+		a.r.POST("/api/v1/company/import", a.RequireRole(models.RoleWriter), a.ImportItems)
+		a.r.GET("/api/v1/jobs/:id", a.RequireRole(models.RoleWriter), a.GetJob)
+	}
+	if a.webhooks != nil {
+		a.r.POST("/api/v1/webhooks", a.RequireRole(models.RoleWriter), a.CreateWebhook)
+		a.r.GET("/api/v1/webhooks", a.RequireRole(models.RoleWriter), a.ListWebhooks)
+		a.r.GET("/api/v1/webhooks/:id", a.RequireRole(models.RoleWriter), a.GetWebhook)
+		a.r.PUT("/api/v1/webhooks/:id", a.RequireRole(models.RoleWriter), a.ReplaceWebhook)
+		a.r.DELETE("/api/v1/webhooks/:id", a.RequireRole(models.RoleWriter), a.DeleteWebhook)
+		a.r.GET("/api/v1/webhooks/:id/deliveries", a.RequireRole(models.RoleWriter), a.ListWebhookDeliveries)
+	}
+	if a.audit != nil {
+		a.r.GET("/api/v1/audit", a.RequireRole(models.RoleAuditor), a.ListAuditRecords)
+	}
 }
 
 func (a *api) AbortWithError(ctx *gin.Context, code int, err error) {
@@ -60,35 +153,86 @@ func (a *api) AbortWithError(ctx *gin.Context, code int, err error) {
 	ctx.AbortWithStatusJSON(code, e)
 }
 
+// abortWithDuplicateName adds id of the company which already has the name, if storage reported it
+func (a *api) abortWithDuplicateName(ctx *gin.Context, err error) {
+	e := models.ErrorResponse{Error: models.ErrDuplicateName.Error()}
+	var dup *models.DuplicateNameError
+	if errors.As(err, &dup) {
+		e.ConflictingID = &dup.ID
+	}
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, e)
+}
+
+// abortWithDBError reports storage failure, timeouts and unavailable DB get distinct statuses so clients could retry them
+func (a *api) abortWithDBError(ctx *gin.Context, err error) {
+	code, err := dbError(err)
+	if code == http.StatusServiceUnavailable {
+		ctx.Header("Retry-After", retryAfterUnavailable)
+	}
+	a.AbortWithError(ctx, code, err)
+}
+
+func dbError(err error) (int, error) {
+	switch {
+	case errors.Is(err, models.ErrDBTimeout):
+		return http.StatusGatewayTimeout, models.ErrDBTimeout
+	case errors.Is(err, models.ErrDBUnavailable):
+		return http.StatusServiceUnavailable, models.ErrDBUnavailable
+	}
+	return http.StatusInternalServerError, models.ErrDBError
+}
+
 func (a *api) RequireRole(role string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		h := ctx.GetHeader("Authorization")
-		parts := strings.Split(h, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			a.log.Error().Msg("Authorization header is invalid")
-			a.AbortWithError(ctx, http.StatusForbidden, models.ErrJWTInvalid)
-			return
-		}
-		hasRole, err := a.auth.TokenHasRole(parts[1], role)
-		if err != nil {
-			a.log.Err(err).Msg("Authorization check failed")
-			a.AbortWithError(ctx, http.StatusForbidden, models.ErrJWTInvalid)
-			return
-		}
-		if !hasRole {
-			a.log.Err(err).Msg("Access denied")
-			a.AbortWithError(ctx, http.StatusForbidden, models.ErrJWTRoleMissing)
-			return
-		}
+		a.withRole(ctx, role, ctx.Next)
+	}
+}
+
+// withRole runs next if request token has the role and records the request to audit log afterwards
+func (a *api) withRole(ctx *gin.Context, role string, next func()) {
+	token, ok := bearerToken(ctx.Request)
+	if !ok {
+		a.log.Error().Msg("Authorization header is invalid")
+		a.AbortWithError(ctx, http.StatusForbidden, models.ErrJWTInvalid)
+		return
+	}
+	identity, err := a.auth.ParseToken(token)
+	if err != nil {
+		a.log.Err(err).Msg("Authorization check failed")
+		a.AbortWithError(ctx, http.StatusForbidden, models.ErrJWTInvalid)
+		return
+	}
+	if !identity.HasRole(role) {
+		a.log.Error().Str("Role", role).Msg("Access denied")
+		a.AbortWithError(ctx, http.StatusForbidden, models.ErrJWTRoleMissing)
+		return
+	}
+	ctx.Set(identityKey, identity)
+
+	next()
 
+	if a.audit != nil {
+		a.recordAudit(ctx, identity)
+	}
+}
+
+// requestIDMiddleware keeps client-supplied request ID or generates a new one
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(headerRequestID)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		ctx.Set(requestIDKey, id)
+		ctx.Header(headerRequestID, id)
 		ctx.Next()
 	}
 }
 
-func corsMiddleware() gin.HandlerFunc {
+func corsMiddleware(origins []string) gin.HandlerFunc {
 	return cors.New(cors.Config{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{"GET", "POST", "PATCH", "DELETE"},
+		AllowOrigins: origins,
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
 		AllowHeaders: []string{
 			"Origin",
 			"Content-Type",
@@ -101,8 +245,13 @@ func corsMiddleware() gin.HandlerFunc {
 			"origin",
 			"Cache-Control",
 			"X-Requested-With",
+			"If-Match",
+			"Prefer",
+			"Last-Event-ID",
+			headerRequestID,
+			headerReadPrimary,
 		},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Preference-Applied", headerRequestID, headerReadPrimary, headerWarning},
 		AllowCredentials: true,
 	})
 }
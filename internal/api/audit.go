@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const maxAuditLimit = 1000
+
+func (a *api) ListAuditRecords(ctx *gin.Context) {
+	var (
+		f   models.AuditFilter
+		err error
+	)
+	f.CompanyID = ctx.Query("company_id")
+	f.Principal = ctx.Query("principal")
+	if v := ctx.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			a.log.Err(err).Str("From", v).Msg("invalid audit filter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidFilter)
+			return
+		}
+		f.From = &t
+	}
+	if v := ctx.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			a.log.Err(err).Str("To", v).Msg("invalid audit filter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidFilter)
+			return
+		}
+		f.To = &t
+	}
+	if v := ctx.Query("limit"); v != "" {
+		f.Limit, err = strconv.Atoi(v)
+		if err != nil || f.Limit < 1 || f.Limit > maxAuditLimit {
+			a.log.Error().Str("Limit", v).Msg("invalid audit filter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidFilter)
+			return
+		}
+	}
+
+	list, err := a.audit.ListAuditRecords(ctx, &f)
+	if err != nil {
+		a.log.Err(err).Msg("db audit request failed")
+		a.abortWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, list)
+}
+
+// recordAudit writes a record per company touched by the request, handlers working with
+// several companies list them under auditCompanyIDsKey, others have the id in the route
+func (a *api) recordAudit(ctx *gin.Context, identity *models.Identity) {
+	route := ctx.FullPath()
+	if action := ctx.Param("action"); action != "" {
+		route = strings.TrimSuffix(route, ":action") + action
+	}
+	r := models.AuditRecord{
+		Method:    ctx.Request.Method,
+		Route:     route,
+		CompanyID: ctx.Param("id"),
+		Principal: identity.Subject,
+		Status:    ctx.Writer.Status(),
+		ClientIP:  ctx.ClientIP(),
+		RequestID: ctx.GetString(requestIDKey),
+	}
+	list := []models.AuditRecord{r}
+	if ids := ctx.GetStringSlice(auditCompanyIDsKey); len(ids) > 0 {
+		list = make([]models.AuditRecord, len(ids))
+		for n, id := range ids {
+			list[n] = r
+			list[n].CompanyID = id
+		}
+	}
+	// request could be already cancelled by client, but the record must be written anyway
+	err := a.audit.AddAuditRecords(context.WithoutCancel(ctx.Request.Context()), list)
+	if err != nil {
+		a.log.Err(err).Interface("Records", list).Msg("audit record failed")
+	}
+}
+
+// setAuditCompanyIDs lists companies touched by the request for audit log
+func setAuditCompanyIDs(ctx *gin.Context, ids []uuid.UUID) {
+	list := make([]string, len(ids))
+	for n, id := range ids {
+		list[n] = id.String()
+	}
+	ctx.Set(auditCompanyIDsKey, list)
+}
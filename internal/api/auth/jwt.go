@@ -28,26 +28,42 @@ func New(key string) (*auth, error) {
 }
 
 func (a *auth) Generate(roles []string) (string, error) {
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"roles": roles,
-		},
-	)
+	return a.GenerateWithSubject("", roles)
+}
+
+func (a *auth) GenerateWithSubject(subject string, roles []string) (string, error) {
+	claims := jwt.MapClaims{
+		"roles": roles,
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return t.SignedString(a.key)
 }
 
 func (a *auth) TokenHasRole(tokenString, role string) (bool, error) {
+	i, err := a.ParseToken(tokenString)
+	if err != nil {
+		return false, err
+	}
+	return i.HasRole(role), nil
+}
+
+func (a *auth) ParseToken(tokenString string) (*models.Identity, error) {
 	var i identity
 	_, err := jwt.ParseWithClaims(tokenString, &i, a.keyfunc())
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	for _, r := range i.Roles {
-		if r == role {
-			return true, nil
-		}
+	res := models.Identity{
+		Subject: i.Subject,
+		Roles:   i.Roles,
+	}
+	if i.ExpiresAt != nil {
+		res.ExpiresAt = i.ExpiresAt.Time
 	}
-	return false, nil
+	return &res, nil
 }
 
 func (a *auth) keyfunc() jwt.Keyfunc {
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	defaultBatchLimit    = 100
+	defaultBatchGetLimit = 500
+)
+
+// WithBatchLimit sets max number of operations in one batch request
+func WithBatchLimit(limit int) Option {
+	return func(a *api) {
+		a.batchLimit = limit
+	}
+}
+
+// WithBatchGetLimit sets max number of ids in one batch get request, reads are cheaper than writes,
+// so the limit is separate from the batch one
+func WithBatchGetLimit(limit int) Option {
+	return func(a *api) {
+		a.batchGetLimit = limit
+	}
+}
+
+// companyAction is a custom method like "/api/v1/company:batch" with the role it requires
+type companyAction struct {
+	role    string
+	handler func(a *api, ctx *gin.Context)
+}
+
+// gin has no literal colons in routes, so custom methods share "/api/v1/company:action" route
+// and anything not listed here is not found
+var companyActions = map[string]companyAction{
+	":batch":    {role: models.RoleWriter, handler: (*api).BatchItems},
+	":batchGet": {role: models.RoleReader, handler: (*api).BatchGetItems},
+}
+
+// CompanyAction dispatches custom methods, unknown ones are rejected before authorization
+func (a *api) CompanyAction(ctx *gin.Context) {
+	action, ok := companyActions[ctx.Param("action")]
+	if !ok {
+		a.log.Error().Str("Action", ctx.Param("action")).Msg("unknown company action")
+		a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		return
+	}
+	a.withRole(ctx, action.role, func() {
+		action.handler(a, ctx)
+	})
+}
+
+func (a *api) BatchItems(ctx *gin.Context) {
+	var req models.BatchRequest
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		a.log.Err(err).Msg("invalid batch request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
+	}
+
+	if len(req.Operations) == 0 {
+		a.log.Error().Msg("empty batch request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrNothingToDo)
+		return
+	}
+	if len(req.Operations) > a.batchLimit {
+		a.log.Error().Int("Count", len(req.Operations)).Msg("batch request is too large")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrBatchTooLarge)
+		return
+	}
+
+	results := make([]models.BatchResult, len(req.Operations))
+	var (
+		items   []models.BatchItem
+		indexes []int
+		invalid bool
+	)
+	for n, op := range req.Operations {
+		results[n] = models.BatchResult{Index: n, Op: op.Op, ID: op.ID}
+		item, err := batchItem(&op)
+		if err != nil {
+			a.log.Err(err).Int("Index", n).Msg("invalid batch operation")
+			setBatchError(&results[n], err)
+			invalid = true
+			continue
+		}
+		items = append(items, *item)
+		indexes = append(indexes, n)
+	}
+
+	if invalid && req.Atomic {
+		setAuditCompanyIDs(ctx, batchResultIDs(results))
+		for n := range results {
+			if results[n].Error == "" {
+				setBatchError(&results[n], models.ErrBatchAborted)
+			}
+		}
+		ctx.JSON(http.StatusMultiStatus, models.BatchResponse{Results: results})
+		return
+	}
+
+	if len(items) > 0 {
+		res, err := a.stor.ApplyBatch(ctx, items, req.Atomic)
+		if err != nil {
+			a.log.Err(err).Msg("db batch request failed")
+			a.abortWithDBError(ctx, err)
+			return
+		}
+		for k, r := range res {
+			n := indexes[k]
+			if r.Err != nil {
+				a.log.Err(r.Err).Int("Index", n).Msg("batch operation failed")
+				setBatchError(&results[n], r.Err)
+				continue
+			}
+			results[n].ID = &r.Item.ID
+			results[n].Item = r.Item
+			results[n].Status = http.StatusOK
+			if items[k].Op == models.BatchOpCreate {
+				results[n].Status = http.StatusCreated
+			}
+			a.sendNotification(ctx, models.EventNotifications{ID: r.Item.ID, Event: batchEvent(items[k].Op)})
+		}
+	}
+
+	setAuditCompanyIDs(ctx, batchResultIDs(results))
+	ctx.JSON(http.StatusMultiStatus, models.BatchResponse{Results: results})
+}
+
+// batchResultIDs lists companies addressed by operations or created by them
+func batchResultIDs(results []models.BatchResult) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, r := range results {
+		if r.ID != nil {
+			ids = append(ids, *r.ID)
+		}
+	}
+	return ids
+}
+
+// GetItems returns companies listed in "ids" query parameter, comma-separated or repeated
+func (a *api) GetItems(ctx *gin.Context) {
+	var ids []uuid.UUID
+	for _, v := range ctx.QueryArray("ids") {
+		for _, s := range strings.Split(v, ",") {
+			id, err := uuid.Parse(strings.TrimSpace(s))
+			if err != nil {
+				a.log.Err(err).Msg("invalid id")
+				a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+				return
+			}
+			ids = append(ids, id)
+		}
+	}
+	a.getItems(ctx, ids)
+}
+
+// BatchGetItems is GetItems with ids in request body, for lists which don't fit into URL
+func (a *api) BatchGetItems(ctx *gin.Context) {
+	var req models.BatchGetRequest
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		a.log.Err(err).Msg("invalid batch get request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
+	}
+	a.getItems(ctx, req.IDs)
+}
+
+func (a *api) getItems(ctx *gin.Context, requested []uuid.UUID) {
+	var ids []uuid.UUID
+	seen := map[uuid.UUID]struct{}{}
+	for _, id := range requested {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		a.log.Error().Msg("empty batch get request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrNothingToDo)
+		return
+	}
+	if len(ids) > a.batchGetLimit {
+		a.log.Error().Int("Count", len(ids)).Msg("batch get request is too large")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrBatchTooLarge)
+		return
+	}
+	setAuditCompanyIDs(ctx, ids)
+
+	list, err := a.stor.GetItems(ctx, ids)
+	if err != nil {
+		a.log.Err(err).Msg("db batch select request failed")
+		a.abortWithDBError(ctx, err)
+		return
+	}
+
+	found := make(map[uuid.UUID]models.ItemResponse, len(list))
+	for _, i := range list {
+		found[i.ID] = i
+	}
+	res := models.BatchGetResponse{
+		Items:   []models.ItemResponse{},
+		Missing: []uuid.UUID{},
+	}
+	for _, id := range ids {
+		if i, ok := found[id]; ok {
+			res.Items = append(res.Items, i)
+		} else {
+			res.Missing = append(res.Missing, id)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
+
+// batchItem validates operation the same way as single-item handlers do
+func batchItem(op *models.BatchOperation) (*models.BatchItem, error) {
+	item := models.BatchItem{Op: op.Op}
+	switch op.Op {
+	case models.BatchOpCreate:
+		var req models.ItemCreateRequest
+		err := json.Unmarshal(op.Data, &req)
+		if err != nil {
+			return nil, models.ErrInvalidRequest
+		}
+		err = req.Validate()
+		if err != nil {
+			return nil, err
+		}
+		item.Create = &req
+	case models.BatchOpUpdate:
+		if op.ID == nil {
+			return nil, models.ErrInvalidID
+		}
+		var req models.ItemUpdateRequest
+		err := json.Unmarshal(op.Data, &req)
+		if err != nil {
+			return nil, models.ErrInvalidRequest
+		}
+		err = req.Validate()
+		if err != nil {
+			return nil, err
+		}
+		item.ID = *op.ID
+		item.Update = &req
+	case models.BatchOpDelete:
+		if op.ID == nil {
+			return nil, models.ErrInvalidID
+		}
+		item.ID = *op.ID
+	default:
+		return nil, models.ErrInvalidOperation
+	}
+	return &item, nil
+}
+
+func setBatchError(r *models.BatchResult, err error) {
+	var dup *models.DuplicateNameError
+	if errors.As(err, &dup) {
+		r.ConflictingID = &dup.ID
+		err = models.ErrDuplicateName
+	}
+	switch err {
+	case models.ErrNotFound:
+		r.Status = http.StatusNotFound
+	case models.ErrBatchAborted:
+		r.Status = http.StatusFailedDependency
+	case models.ErrDuplicateName, models.ErrInvalidID, models.ErrInvalidName, models.ErrInvalidDescription,
+		models.ErrInvalidEmployeeCount, models.ErrInvalidType, models.ErrInvalidRequest, models.ErrInvalidOperation,
+		models.ErrNothingToDo:
+		r.Status = http.StatusBadRequest
+	default:
+		r.Status, err = dbError(err)
+	}
+	r.Error = err.Error()
+}
+
+func batchEvent(op string) string {
+	switch op {
+	case models.BatchOpCreate:
+		return models.EventTypeCreated
+	case models.BatchOpDelete:
+		return models.EventTypeDeleted
+	}
+	return models.EventTypeUpdated
+}
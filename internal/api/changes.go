@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// ListChanges returns changes of all companies after "since" sequence number,
+// since=0 returns the feed from the beginning
+func (a *api) ListChanges(ctx *gin.Context) {
+	var (
+		since int64
+		limit = defaultChangesLimit
+		err   error
+	)
+	if v := ctx.Query("since"); v != "" {
+		since, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || since < 0 {
+			a.log.Error().Str("Since", v).Msg("invalid changes filter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidFilter)
+			return
+		}
+	}
+	if v := ctx.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxChangesLimit {
+			a.log.Error().Str("Limit", v).Msg("invalid changes filter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidFilter)
+			return
+		}
+	}
+
+	list, err := a.stor.ListChanges(ctx, since, limit)
+	if err != nil {
+		a.log.Err(err).Msg("db changes request failed")
+		a.abortWithDBError(ctx, err)
+		return
+	}
+
+	res := models.ChangesResponse{Changes: list, Next: since}
+	if len(list) > 0 {
+		res.Next = list[len(list)-1].Seq
+	}
+	ctx.JSON(http.StatusOK, res)
+}
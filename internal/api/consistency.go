@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	readPrimaryCookie = "read_primary_until"
+	headerReadPrimary = "X-Read-Primary-Until"
+)
+
+// WithReadYourWrites sends reads of a client to primary DB for window after its write.
+// The deadline is returned in cookie and header, client could pass either of them back.
+func WithReadYourWrites(window time.Duration) Option {
+	return func(a *api) {
+		a.readPrimaryWindow = window
+	}
+}
+
+func (a *api) readYourWritesMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		now := time.Now()
+		until := readPrimaryUntil(ctx)
+		// deadline is set by the client, so it's ignored if it's too far in the future
+		if until.After(now) && !until.After(now.Add(a.readPrimaryWindow)) {
+			ctx.Set(models.ReadPrimaryKey, true)
+		}
+
+		switch ctx.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			ctx.Next()
+			return
+		}
+		w := &readPrimaryWriter{
+			ResponseWriter: ctx.Writer,
+			cookie: &http.Cookie{
+				Name:     readPrimaryCookie,
+				Value:    strconv.FormatInt(now.Add(a.readPrimaryWindow).UnixMilli(), 10),
+				MaxAge:   int((a.readPrimaryWindow + time.Second - 1) / time.Second),
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			},
+		}
+		ctx.Writer = w
+		ctx.Next()
+		// handler could set only the status, gin writes it after the chain
+		w.setDeadline()
+	}
+}
+
+// readPrimaryWriter adds read-your-writes deadline to the response just before its headers are written,
+// the deadline is returned only for successful writes
+type readPrimaryWriter struct {
+	gin.ResponseWriter
+	cookie *http.Cookie
+	done   bool
+}
+
+func (w *readPrimaryWriter) setDeadline() {
+	if w.done || w.ResponseWriter.Written() {
+		return
+	}
+	w.done = true
+	if w.Status() < 200 || w.Status() >= 300 {
+		return
+	}
+	w.Header().Add("Set-Cookie", w.cookie.String())
+	w.Header().Set(headerReadPrimary, w.cookie.Value)
+}
+
+func (w *readPrimaryWriter) WriteHeaderNow() {
+	w.setDeadline()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *readPrimaryWriter) Write(data []byte) (int, error) {
+	w.setDeadline()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *readPrimaryWriter) WriteString(s string) (int, error) {
+	w.setDeadline()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *readPrimaryWriter) Flush() {
+	w.setDeadline()
+	w.ResponseWriter.Flush()
+}
+
+// readPrimaryUntil returns deadline from request header or cookie, zero time if there is none
+func readPrimaryUntil(ctx *gin.Context) time.Time {
+	v := ctx.GetHeader(headerReadPrimary)
+	if v == "" {
+		v, _ = ctx.Cookie(readPrimaryCookie)
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
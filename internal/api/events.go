@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const sseHeartbeat = 15 * time.Second
+
+// WithEvents enables server-sent events endpoint
+func WithEvents(events models.EventStreamInt) Option {
+	return func(a *api) {
+		a.events = events
+	}
+}
+
+// StreamEvents sends company notifications as server-sent events.
+// Client could resume with "Last-Event-ID" header or "last_event_id" query parameter,
+// "reset" event means that some events were lost and the state should be reloaded.
+// Stream is closed when the token expires.
+func (a *api) StreamEvents(ctx *gin.Context) {
+	lastID := ctx.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = ctx.Query("last_event_id")
+	}
+	sub := a.events.Subscribe(lastID)
+	defer sub.Cancel()
+
+	var expired <-chan time.Time
+	if v, ok := ctx.Get(identityKey); ok {
+		if identity := v.(*models.Identity); !identity.ExpiresAt.IsZero() {
+			t := time.NewTimer(time.Until(identity.ExpiresAt))
+			defer t.Stop()
+			expired = t.C
+		}
+	}
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	if sub.Reset {
+		fmt.Fprint(ctx.Writer, "event: reset\ndata: {}\n\n")
+	}
+	for _, e := range sub.Backlog {
+		a.writeEvent(ctx, &e)
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-expired:
+			a.log.Info().Msg("token expired, closing event stream")
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(ctx.Writer, ": ping\n\n")
+		case e, ok := <-sub.C:
+			if !ok {
+				a.log.Warn().Msg("event stream subscriber is too slow, closing")
+				return
+			}
+			a.writeEvent(ctx, &e)
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+func (a *api) writeEvent(ctx *gin.Context, e *models.Event) {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		a.log.Err(err).Msg("event marshal failed")
+		return
+	}
+	fmt.Fprintf(ctx.Writer, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Data.Event, data)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+var exportCSVHeader = []string{"id", "name", "description", "employee_count", "is_registered", "type"}
+
+var exportExtensions = map[string]string{
+	mimeCSV:    "csv",
+	mimeNDJSON: "ndjson",
+}
+
+// ExportItems streams filtered companies as CSV or NDJSON depending on "Accept" header
+func (a *api) ExportItems(ctx *gin.Context) {
+	f, err := parseItemFilter(ctx)
+	if err != nil {
+		a.log.Err(err).Msg("invalid export filter")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	format := ctx.NegotiateFormat(mimeNDJSON, mimeCSV)
+	if format == "" {
+		a.log.Error().Str("Accept", ctx.GetHeader("Accept")).Msg("unsupported export format")
+		a.AbortWithError(ctx, http.StatusNotAcceptable, models.ErrNotAcceptable)
+		return
+	}
+
+	var (
+		started bool
+		csvW    *csv.Writer
+		enc     *json.Encoder
+	)
+	// response is started with the first row, so DB errors before it are reported with proper status
+	start := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		ctx.Header("Content-Type", format)
+		ctx.Header("Content-Disposition", `attachment; filename="companies.`+exportExtensions[format]+`"`)
+		ctx.Status(http.StatusOK)
+		if format == mimeCSV {
+			csvW = csv.NewWriter(ctx.Writer)
+			return csvW.Write(exportCSVHeader)
+		}
+		enc = json.NewEncoder(ctx.Writer)
+		return nil
+	}
+	write := func(i *models.ItemResponse) error {
+		err := start()
+		if err != nil {
+			return err
+		}
+		if enc != nil {
+			return enc.Encode(i)
+		}
+		err = csvW.Write([]string{
+			i.ID.String(),
+			i.Name,
+			i.Description,
+			strconv.Itoa(i.EmployeeCount),
+			strconv.FormatBool(i.IsRegistered),
+			i.Type,
+		})
+		if err != nil {
+			return err
+		}
+		csvW.Flush()
+		return csvW.Error()
+	}
+
+	err = a.stor.ExportItems(ctx, f, write)
+	if err != nil {
+		a.log.Err(err).Msg("db export request failed")
+		if !started {
+			a.abortWithDBError(ctx, err)
+			return
+		}
+		abortStream(ctx)
+		return
+	}
+
+	// empty export still has CSV header
+	err = start()
+	if err == nil && csvW != nil {
+		csvW.Flush()
+		err = csvW.Error()
+	}
+	if err != nil {
+		a.log.Err(err).Msg("export write failed")
+	}
+}
+
+// abortStream breaks partially sent response, so client doesn't take it as complete
+func abortStream(ctx *gin.Context) {
+	ctx.Abort()
+	conn, _, err := ctx.Writer.Hijack()
+	if err == nil {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// parseItemFilter reads companies filter from query parameters
+func parseItemFilter(ctx *gin.Context) (*models.ItemFilter, error) {
+	f := models.ItemFilter{
+		Name: ctx.Query("name"),
+		Type: ctx.Query("type"),
+	}
+	if f.Type != "" {
+		if _, ok := models.AcceptableLegalTypes[f.Type]; !ok {
+			return nil, models.ErrInvalidFilter
+		}
+	}
+	if v := ctx.Query("is_registered"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, models.ErrInvalidFilter
+		}
+		f.IsRegistered = &b
+	}
+	if v := ctx.Query("min_employees"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, models.ErrInvalidFilter
+		}
+		f.MinEmployees = &n
+	}
+	if v := ctx.Query("max_employees"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, models.ErrInvalidFilter
+		}
+		f.MaxEmployees = &n
+	}
+	return &f, nil
+}
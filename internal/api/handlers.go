@@ -1,15 +1,21 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"unicode/utf8"
 
 	"github.com/mannulus-immortalis/xmtask/internal/models"
 )
 
+const (
+	preferRepresentation = "representation"
+	preferMinimal        = "minimal"
+)
+
 func (a *api) Alive(ctx *gin.Context) {
 	ctx.String(http.StatusOK, "ok")
 }
@@ -23,48 +29,42 @@ func (a *api) CreateItem(ctx *gin.Context) {
 		return
 	}
 
-	if req.Name == "" || utf8.RuneCountInString(req.Name) > 15 {
-		a.log.Error().Msg("invalid name")
-		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidName)
-		return
-	}
-
-	if utf8.RuneCountInString(req.Description) > 3000 {
-		a.log.Error().Msg("invalid description")
-		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidDescription)
+	err = req.Validate()
+	if err != nil {
+		a.log.Err(err).Msg("create request validation failed")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
 		return
 	}
 
-	if _, ok := models.AcceptableLegalTypes[req.Type]; !ok {
-		a.log.Error().Str("Type", req.Type).Msg("invalid type")
-		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidType)
+	warnings, ok := a.checkSimilar(ctx, req.Name)
+	if !ok {
 		return
 	}
 
 	id, err := a.stor.CreateItem(ctx, &req)
 	if err != nil {
 		a.log.Err(err).Msg("db create request failed")
-		switch err {
-		case models.ErrDuplicateName:
-			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrDuplicateName)
+		switch {
+		case errors.Is(err, models.ErrDuplicateName):
+			a.abortWithDuplicateName(ctx, err)
 		default:
-			a.AbortWithError(ctx, http.StatusInternalServerError, models.ErrDBError)
+			a.abortWithDBError(ctx, err)
 		}
 		return
 	}
-	item := models.ItemResponse{
-		ID:            *id,
-		Name:          req.Name,
-		Description:   req.Description,
-		EmployeeCount: req.EmployeeCount,
-		IsRegistered:  req.IsRegistered,
-		Type:          req.Type,
+	item := models.ItemCreateResponse{
+		ItemResponse: models.ItemResponse{
+			ID:            *id,
+			Name:          req.Name,
+			Description:   req.Description,
+			EmployeeCount: req.EmployeeCount,
+			IsRegistered:  req.IsRegistered,
+			Type:          req.Type,
+		},
+		Warnings: warnings,
 	}
 
-	err = a.notify.Send(models.EventNotifications{ID: *id, Event: models.EventTypeCreated})
-	if err != nil {
-		a.log.Err(err).Msg("notification send failed")
-	}
+	a.sendNotification(ctx, models.EventNotifications{ID: *id, Event: models.EventTypeCreated})
 
 	ctx.JSON(http.StatusCreated, item)
 }
@@ -77,6 +77,17 @@ func (a *api) UpdateItem(ctx *gin.Context) {
 		return
 	}
 
+	switch ctx.ContentType() {
+	case mimeMergePatch, mimeJSONPatch:
+		a.patchItem(ctx, id)
+		return
+	case "", gin.MIMEJSON:
+	default:
+		a.log.Error().Str("ContentType", ctx.ContentType()).Msg("unsupported content type")
+		a.AbortWithError(ctx, http.StatusUnsupportedMediaType, models.ErrUnsupportedMedia)
+		return
+	}
+
 	var req models.ItemUpdateRequest
 	err = ctx.BindJSON(&req)
 	if err != nil {
@@ -85,52 +96,87 @@ func (a *api) UpdateItem(ctx *gin.Context) {
 		return
 	}
 
-	if req.Name == nil && req.Description == nil && req.EmployeeCount == nil && req.IsRegistered == nil && req.Type == nil {
-		a.log.Error().Msg("empty update request")
-		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrNothingToDo)
+	err = req.Validate()
+	if err != nil {
+		a.log.Err(err).Msg("update request validation failed")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
 		return
 	}
 
-	if req.Name != nil && (*req.Name == "" || utf8.RuneCountInString(*req.Name) > 15) {
-		a.log.Error().Msg("invalid name")
-		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidName)
+	item, err := a.stor.UpdateItem(ctx, id, &req)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db update request failed")
+		switch {
+		case err == models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		case errors.Is(err, models.ErrDuplicateName):
+			a.abortWithDuplicateName(ctx, err)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
 		return
 	}
 
-	if req.Description != nil && utf8.RuneCountInString(*req.Description) > 3000 {
-		a.log.Error().Msg("invalid description")
-		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidDescription)
+	a.sendNotification(ctx, models.EventNotifications{ID: id, Event: models.EventTypeUpdated})
+
+	a.respondItem(ctx, item)
+}
+
+// ReplaceItem overwrites all fields of the item, creating it at the given ID if it does not exist.
+// "If-Match: *" header disables creation.
+func (a *api) ReplaceItem(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
 		return
 	}
 
-	if req.Type != nil {
-		if _, ok := models.AcceptableLegalTypes[*req.Type]; !ok {
-			a.log.Error().Str("Type", *req.Type).Msg("invalid type")
-			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidType)
-			return
-		}
+	var req models.ItemCreateRequest
+	err = ctx.BindJSON(&req)
+	if err != nil {
+		a.log.Err(err).Msg("invalid replace request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
 	}
 
-	err = a.stor.UpdateItem(ctx, id, &req)
+	err = req.Validate()
 	if err != nil {
-		a.log.Err(err).Str("ID", id.String()).Msg("db update request failed")
-		switch err {
-		case models.ErrNotFound:
+		a.log.Err(err).Msg("replace request validation failed")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	upsert := ctx.GetHeader("If-Match") != "*"
+	created, err := a.stor.ReplaceItem(ctx, id, &req, upsert)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db replace request failed")
+		switch {
+		case err == models.ErrNotFound:
 			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
-		case models.ErrDuplicateName:
-			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrDuplicateName)
+		case errors.Is(err, models.ErrDuplicateName):
+			a.abortWithDuplicateName(ctx, err)
 		default:
-			a.AbortWithError(ctx, http.StatusInternalServerError, models.ErrDBError)
+			a.abortWithDBError(ctx, err)
 		}
 		return
 	}
+	item := models.ItemResponse{
+		ID:            id,
+		Name:          req.Name,
+		Description:   req.Description,
+		EmployeeCount: req.EmployeeCount,
+		IsRegistered:  req.IsRegistered,
+		Type:          req.Type,
+	}
 
-	err = a.notify.Send(models.EventNotifications{ID: id, Event: models.EventTypeUpdated})
-	if err != nil {
-		a.log.Err(err).Msg("notification send failed")
+	event, status := models.EventTypeUpdated, http.StatusOK
+	if created {
+		event, status = models.EventTypeCreated, http.StatusCreated
 	}
+	a.sendNotification(ctx, models.EventNotifications{ID: id, Event: event})
 
-	ctx.Status(http.StatusOK)
+	ctx.JSON(status, item)
 }
 
 func (a *api) DeleteItem(ctx *gin.Context) {
@@ -141,24 +187,58 @@ func (a *api) DeleteItem(ctx *gin.Context) {
 		return
 	}
 
-	err = a.stor.DeleteItem(ctx, id)
+	item, err := a.stor.DeleteItem(ctx, id)
 	if err != nil {
 		a.log.Err(err).Str("ID", id.String()).Msg("db delete request failed")
 		switch err {
 		case models.ErrNotFound:
 			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
 		default:
-			a.AbortWithError(ctx, http.StatusInternalServerError, models.ErrDBError)
+			a.abortWithDBError(ctx, err)
 		}
 		return
 	}
 
-	err = a.notify.Send(models.EventNotifications{ID: id, Event: models.EventTypeDeleted})
+	a.sendNotification(ctx, models.EventNotifications{ID: id, Event: models.EventTypeDeleted})
+
+	a.respondItem(ctx, item)
+}
+
+// sendNotification reports critical notifier failure with Warning header, the change is already
+// committed at this point, so the request keeps its success status and clients don't retry it
+func (a *api) sendNotification(ctx *gin.Context, event models.EventNotifications) {
+	err := a.notify.Send(event)
 	if err != nil {
-		a.log.Err(err).Msg("notification send failed")
+		a.log.Err(err).Str("ID", event.ID.String()).Msg("notification send failed")
+		ctx.Header(headerWarning, warningNotifyFailed)
 	}
+}
 
-	ctx.Status(http.StatusOK)
+// respondItem writes item to response only if client asked for it with "Prefer: return=representation"
+func (a *api) respondItem(ctx *gin.Context, item *models.ItemResponse) {
+	switch preferredReturn(ctx) {
+	case preferRepresentation:
+		ctx.Header("Preference-Applied", "return="+preferRepresentation)
+		ctx.JSON(http.StatusOK, item)
+	case preferMinimal:
+		ctx.Header("Preference-Applied", "return="+preferMinimal)
+		ctx.Status(http.StatusOK)
+	default:
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// preferredReturn returns value of "return" preference from RFC 7240 "Prefer" headers
+func preferredReturn(ctx *gin.Context) string {
+	for _, h := range ctx.Request.Header.Values("Prefer") {
+		for _, pref := range strings.Split(h, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(pref), "=")
+			if strings.EqualFold(name, "return") {
+				return strings.Trim(value, `"`)
+			}
+		}
+	}
+	return ""
 }
 
 func (a *api) GetItem(ctx *gin.Context) {
@@ -174,9 +254,9 @@ func (a *api) GetItem(ctx *gin.Context) {
 		a.log.Err(err).Str("ID", id.String()).Msg("db select request failed")
 		switch err {
 		case models.ErrNotFound:
-			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+			a.redirectMerged(ctx, id)
 		default:
-			a.AbortWithError(ctx, http.StatusInternalServerError, models.ErrDBError)
+			a.abortWithDBError(ctx, err)
 		}
 		return
 	}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const maxImportSize = 32 << 20
+
+var importFormats = map[string]string{
+	mimeCSV:    models.ImportFormatCSV,
+	mimeNDJSON: models.ImportFormatNDJSON,
+}
+
+// WithImporter enables asynchronous bulk import endpoints
+func WithImporter(imp models.ImporterInt) Option {
+	return func(a *api) {
+		a.importer = imp
+	}
+}
+
+// ImportItems stores uploaded CSV or NDJSON file as a background job
+func (a *api) ImportItems(ctx *gin.Context) {
+	format, ok := importFormats[ctx.ContentType()]
+	if !ok {
+		a.log.Error().Str("ContentType", ctx.ContentType()).Msg("unsupported import format")
+		a.AbortWithError(ctx, http.StatusUnsupportedMediaType, models.ErrUnsupportedMedia)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportSize))
+	if err != nil {
+		a.log.Err(err).Msg("invalid import request")
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			a.AbortWithError(ctx, http.StatusRequestEntityTooLarge, models.ErrPayloadTooLarge)
+			return
+		}
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
+	}
+	if len(payload) == 0 {
+		a.log.Error().Msg("empty import request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrNothingToDo)
+		return
+	}
+
+	id, err := a.importer.Submit(ctx, format, payload)
+	if err != nil {
+		a.log.Err(err).Msg("import job create failed")
+		a.abortWithDBError(ctx, err)
+		return
+	}
+
+	ctx.Header("Location", "/api/v1/jobs/"+id.String())
+	ctx.JSON(http.StatusAccepted, models.ImportSubmitResponse{ID: *id, Status: models.JobStatusPending})
+}
+
+// GetJob reports import job progress and per-row errors
+func (a *api) GetJob(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+
+	job, err := a.importer.GetJob(ctx, id)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db select request failed")
+		switch err {
+		case models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
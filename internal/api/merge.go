@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// MergeItem merges source company into the one from URL in one transaction: fields of the survivor are picked
+// by strategy, the source is soft-deleted and its id is redirected to the survivor
+func (a *api) MergeItem(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+
+	var req models.MergeRequest
+	err = ctx.BindJSON(&req)
+	if err != nil {
+		a.log.Err(err).Msg("invalid merge request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
+	}
+	err = req.Validate()
+	if err != nil {
+		a.log.Err(err).Msg("merge request validation failed")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if req.SourceID == id {
+		a.log.Error().Str("ID", id.String()).Msg("company merged into itself")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrMergeItself)
+		return
+	}
+
+	// both companies are locked before the merged fields are computed, so concurrent updates are not lost;
+	// locks are taken in id order, so concurrent merges of the same pair don't deadlock
+	var merged *models.ItemResponse
+	var invalid error
+	err = a.stor.WithTx(ctx, func(tx models.StorageInt) error {
+		locked := map[uuid.UUID]*models.ItemResponse{}
+		for _, lockID := range lockOrder(id, req.SourceID) {
+			item, err := tx.LockItem(ctx, lockID)
+			if err != nil {
+				return err
+			}
+			locked[lockID] = item
+		}
+		update := mergeFields(locked[id], locked[req.SourceID], &req.Strategy)
+		invalid = update.Validate()
+		if invalid != nil {
+			return invalid
+		}
+		_, err := tx.MergeItem(ctx, req.SourceID, id)
+		if err != nil {
+			return err
+		}
+		// the source is deleted first, so the survivor could take its name
+		merged, err = tx.UpdateItem(ctx, id, update)
+		return err
+	})
+	if invalid != nil {
+		a.log.Err(invalid).Str("ID", id.String()).Str("SourceID", req.SourceID.String()).Msg("merged item validation failed")
+		a.AbortWithError(ctx, http.StatusBadRequest, invalid)
+		return
+	}
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Str("SourceID", req.SourceID.String()).Msg("db merge request failed")
+		switch {
+		case err == models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		case errors.Is(err, models.ErrDuplicateName):
+			a.abortWithDuplicateName(ctx, err)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+
+	a.sendNotification(ctx, models.EventNotifications{ID: id, Event: models.EventTypeMerged, MergedFrom: &req.SourceID})
+
+	ctx.JSON(http.StatusOK, merged)
+}
+
+// lockOrder returns ids in the order their rows are locked
+func lockOrder(a, b uuid.UUID) []uuid.UUID {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return []uuid.UUID{a, b}
+}
+
+// mergeFields returns update of target with field values picked by strategy
+func mergeFields(target, source *models.ItemResponse, s *models.MergeStrategy) *models.ItemUpdateRequest {
+	u := models.ItemUpdateRequest{
+		Name:          &target.Name,
+		Description:   &target.Description,
+		EmployeeCount: &target.EmployeeCount,
+		IsRegistered:  &target.IsRegistered,
+		Type:          &target.Type,
+	}
+	switch s.Name {
+	case models.MergeSource:
+		u.Name = &source.Name
+	case models.MergeLongest:
+		if len([]rune(source.Name)) > len([]rune(target.Name)) {
+			u.Name = &source.Name
+		}
+	}
+	switch s.Description {
+	case models.MergeSource:
+		u.Description = &source.Description
+	case models.MergeLongest:
+		if len([]rune(source.Description)) > len([]rune(target.Description)) {
+			u.Description = &source.Description
+		}
+	}
+	switch s.EmployeeCount {
+	case models.MergeSource:
+		u.EmployeeCount = &source.EmployeeCount
+	case models.MergeMax:
+		u.EmployeeCount = &source.EmployeeCount
+		if target.EmployeeCount > source.EmployeeCount {
+			u.EmployeeCount = &target.EmployeeCount
+		}
+	case models.MergeSum:
+		sum := target.EmployeeCount + source.EmployeeCount
+		u.EmployeeCount = &sum
+	}
+	switch s.IsRegistered {
+	case models.MergeSource:
+		u.IsRegistered = &source.IsRegistered
+	case models.MergeAny:
+		registered := target.IsRegistered || source.IsRegistered
+		u.IsRegistered = &registered
+	}
+	if s.Type == models.MergeSource {
+		u.Type = &source.Type
+	}
+	return &u
+}
+
+// redirectMerged answers lookup of missing company with redirect to the survivor if the company was merged
+func (a *api) redirectMerged(ctx *gin.Context, id uuid.UUID) {
+	into, err := a.stor.GetMergedInto(ctx, id)
+	if err != nil {
+		switch err {
+		case models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		default:
+			a.log.Err(err).Str("ID", id.String()).Msg("db merged request failed")
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+	ctx.Redirect(http.StatusMovedPermanently, "/api/v1/company/"+into.String())
+}
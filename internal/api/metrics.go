@@ -0,0 +1,38 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// WithCacheStats enables metrics endpoint with companies cache counters
+func WithCacheStats(cache models.CacheStatsInt) Option {
+	return func(a *api) {
+		a.cache = cache
+	}
+}
+
+// Metrics returns counters in Prometheus text format, it's not authorized like "/alive"
+func (a *api) Metrics(ctx *gin.Context) {
+	s := a.cache.Stats()
+	var b strings.Builder
+	for _, m := range []struct {
+		name, kind, help string
+		value            uint64
+	}{
+		{"xmtask_cache_hits_total", "counter", "Company lookups served from cache.", s.Hits},
+		{"xmtask_cache_negative_hits_total", "counter", "Lookups of missing companies served from cache.", s.NegativeHits},
+		{"xmtask_cache_misses_total", "counter", "Company lookups which went to storage.", s.Misses},
+		{"xmtask_cache_evictions_total", "counter", "Companies evicted from cache by size limit.", s.Evictions},
+		{"xmtask_cache_invalidations_total", "counter", "Cache invalidations by writes and change events.", s.Invalidations},
+		{"xmtask_cache_entries", "gauge", "Number of cached companies.", uint64(s.Size)},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+	ctx.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
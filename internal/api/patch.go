@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+// fields which must be present in the patched document
+var requiredItemFields = []string{"name", "employee_count", "is_registered", "type"}
+
+// patchItem applies RFC 7386 or RFC 6902 document to the current item state and saves the result
+func (a *api) patchItem(ctx *gin.Context, id uuid.UUID) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		a.log.Err(err).Msg("invalid patch request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
+	}
+
+	// the item is locked from read to write, so "test" operations hold when the result is saved
+	var updated *models.ItemResponse
+	err = a.stor.WithTx(ctx, func(tx models.StorageInt) error {
+		item, err := tx.LockItem(ctx, id)
+		if err != nil {
+			return err
+		}
+		update, err := patchUpdate(ctx, item, body)
+		if err != nil {
+			return err
+		}
+		updated, err = tx.UpdateItem(ctx, id, update)
+		return err
+	})
+	if err != nil {
+		var perr *patchError
+		if errors.As(err, &perr) {
+			a.log.Err(err).Str("ID", id.String()).Msg("patch apply failed")
+			a.AbortWithError(ctx, perr.status, perr.err)
+			return
+		}
+		a.log.Err(err).Str("ID", id.String()).Msg("db patch request failed")
+		switch {
+		case err == models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		case errors.Is(err, models.ErrDuplicateName):
+			a.abortWithDuplicateName(ctx, err)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+
+	a.sendNotification(ctx, models.EventNotifications{ID: id, Event: models.EventTypeUpdated})
+
+	a.respondItem(ctx, updated)
+}
+
+// patchError is a failure of the patch itself, it rolls back the transaction like storage errors
+type patchError struct {
+	status int
+	err    error
+}
+
+func (e *patchError) Error() string {
+	return e.err.Error()
+}
+
+// patchUpdate applies request body to the item and returns update with all fields of the result
+func patchUpdate(ctx *gin.Context, item *models.ItemResponse, body []byte) (*models.ItemUpdateRequest, error) {
+	var err error
+	doc := itemDocument(item)
+	if ctx.ContentType() == mimeMergePatch {
+		doc, err = applyMergePatch(doc, body)
+	} else {
+		doc, err = applyJSONPatch(doc, body)
+	}
+	if err == models.ErrPatchTestFailed {
+		return nil, &patchError{status: http.StatusConflict, err: err}
+	}
+	if err != nil {
+		return nil, &patchError{status: http.StatusBadRequest, err: err}
+	}
+
+	req, err := documentToRequest(item.ID, doc)
+	if err != nil {
+		return nil, &patchError{status: http.StatusBadRequest, err: err}
+	}
+	err = req.Validate()
+	if err != nil {
+		return nil, &patchError{status: http.StatusBadRequest, err: err}
+	}
+	return &models.ItemUpdateRequest{
+		Name:          &req.Name,
+		Description:   &req.Description,
+		EmployeeCount: &req.EmployeeCount,
+		IsRegistered:  &req.IsRegistered,
+		Type:          &req.Type,
+	}, nil
+}
+
+// itemDocument returns generic JSON representation of item with all fields present,
+// value types match the ones produced by json.Unmarshal, so "test" operations could compare them
+func itemDocument(item *models.ItemResponse) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             item.ID.String(),
+		"name":           item.Name,
+		"description":    item.Description,
+		"employee_count": float64(item.EmployeeCount),
+		"is_registered":  item.IsRegistered,
+		"type":           item.Type,
+	}
+}
+
+// documentToRequest converts patched document back to full item state
+func documentToRequest(id uuid.UUID, doc map[string]interface{}) (*models.ItemCreateRequest, error) {
+	if v, ok := doc["id"]; ok {
+		if v != id.String() {
+			return nil, models.ErrInvalidID
+		}
+		delete(doc, "id")
+	}
+	for _, f := range requiredItemFields {
+		if doc[f] == nil {
+			return nil, models.ErrInvalidRequest
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, models.ErrInvalidRequest
+	}
+	var req models.ItemCreateRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&req)
+	if err != nil {
+		return nil, models.ErrInvalidRequest
+	}
+	return &req, nil
+}
+
+// applyMergePatch implements RFC 7386
+func applyMergePatch(doc map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	var p interface{}
+	err := json.Unmarshal(patch, &p)
+	if err != nil {
+		return nil, models.ErrInvalidPatch
+	}
+	res, ok := mergePatch(doc, p).(map[string]interface{})
+	if !ok {
+		return nil, models.ErrInvalidPatch
+	}
+	return res, nil
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// applyJSONPatch implements RFC 6902 for flat documents, only top-level members could be addressed
+func applyJSONPatch(doc map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	var ops []models.PatchOperation
+	err := json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, models.ErrInvalidPatch
+	}
+
+	for _, op := range ops {
+		key, err := pointerKey(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			doc[key] = op.Value
+		case "remove":
+			if _, ok := doc[key]; !ok {
+				return nil, models.ErrInvalidPatch
+			}
+			delete(doc, key)
+		case "replace":
+			if _, ok := doc[key]; !ok {
+				return nil, models.ErrInvalidPatch
+			}
+			doc[key] = op.Value
+		case "move", "copy":
+			from, err := pointerKey(op.From)
+			if err != nil {
+				return nil, err
+			}
+			v, ok := doc[from]
+			if !ok {
+				return nil, models.ErrInvalidPatch
+			}
+			if op.Op == "move" {
+				delete(doc, from)
+			}
+			doc[key] = v
+		case "test":
+			v, ok := doc[key]
+			if !ok || !reflect.DeepEqual(v, op.Value) {
+				return nil, models.ErrPatchTestFailed
+			}
+		default:
+			return nil, models.ErrInvalidPatch
+		}
+	}
+	return doc, nil
+}
+
+// pointerKey returns member name addressed by single-level JSON Pointer (RFC 6901)
+func pointerKey(pointer string) (string, error) {
+	if len(pointer) < 2 || pointer[0] != '/' || strings.Contains(pointer[1:], "/") {
+		return "", models.ErrInvalidPatch
+	}
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[1:]), nil
+}
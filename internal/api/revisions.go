@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+func (a *api) ListRevisions(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+
+	list, err := a.stor.ListRevisions(ctx, id)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db revisions request failed")
+		switch err {
+		case models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, list)
+}
+
+func (a *api) DiffItem(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+
+	from, err := strconv.Atoi(ctx.Query("from"))
+	if err != nil || from < 1 {
+		a.log.Error().Str("From", ctx.Query("from")).Msg("invalid revision")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRevision)
+		return
+	}
+	to, err := strconv.Atoi(ctx.Query("to"))
+	if err != nil || to < 1 {
+		a.log.Error().Str("To", ctx.Query("to")).Msg("invalid revision")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRevision)
+		return
+	}
+
+	revFrom, err := a.stor.GetRevision(ctx, id, from)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Int("Revision", from).Msg("db revision request failed")
+		switch err {
+		case models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+
+	revTo, err := a.stor.GetRevision(ctx, id, to)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Int("Revision", to).Msg("db revision request failed")
+		switch err {
+		case models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.ItemDiffResponse{
+		ID:    id,
+		From:  from,
+		To:    to,
+		Patch: diffItems(&revFrom.Item, &revTo.Item),
+	})
+}
+
+func (a *api) RollbackItem(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+
+	var req models.RollbackRequest
+	err = ctx.BindJSON(&req)
+	if err != nil {
+		a.log.Err(err).Msg("invalid rollback request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
+	}
+	if req.Revision < 1 {
+		a.log.Error().Int("Revision", req.Revision).Msg("invalid revision")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRevision)
+		return
+	}
+
+	rev, err := a.stor.GetRevision(ctx, id, req.Revision)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Int("Revision", req.Revision).Msg("db revision request failed")
+		switch err {
+		case models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+
+	update := models.ItemUpdateRequest{
+		Name:          &rev.Item.Name,
+		Description:   &rev.Item.Description,
+		EmployeeCount: &rev.Item.EmployeeCount,
+		IsRegistered:  &rev.Item.IsRegistered,
+		Type:          &rev.Item.Type,
+	}
+	err = update.Validate()
+	if err != nil {
+		a.log.Err(err).Msg("rollback request validation failed")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = a.stor.UpdateItem(ctx, id, &update)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db update request failed")
+		switch {
+		case err == models.ErrNotFound:
+			a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+		case errors.Is(err, models.ErrDuplicateName):
+			a.abortWithDuplicateName(ctx, err)
+		default:
+			a.abortWithDBError(ctx, err)
+		}
+		return
+	}
+
+	a.sendNotification(ctx, models.EventNotifications{ID: id, Event: models.EventTypeUpdated})
+
+	ctx.Status(http.StatusOK)
+}
+
+// diffItems returns JSON Patch operations turning one item snapshot into another
+func diffItems(from, to *models.ItemResponse) []models.PatchOperation {
+	patch := []models.PatchOperation{}
+	if from.Name != to.Name {
+		patch = append(patch, models.PatchOperation{Op: "replace", Path: "/name", Value: to.Name})
+	}
+	if from.Description != to.Description {
+		patch = append(patch, models.PatchOperation{Op: "replace", Path: "/description", Value: to.Description})
+	}
+	if from.EmployeeCount != to.EmployeeCount {
+		patch = append(patch, models.PatchOperation{Op: "replace", Path: "/employee_count", Value: to.EmployeeCount})
+	}
+	if from.IsRegistered != to.IsRegistered {
+		patch = append(patch, models.PatchOperation{Op: "replace", Path: "/is_registered", Value: to.IsRegistered})
+	}
+	if from.Type != to.Type {
+		patch = append(patch, models.PatchOperation{Op: "replace", Path: "/type", Value: to.Type})
+	}
+	return patch
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	defaultSimilarityThreshold = 0.5
+	defaultStrictThreshold     = 0.8
+	maxCreateWarnings          = 5
+
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 100
+)
+
+type similarity struct {
+	threshold float64
+	strict    float64
+}
+
+// WithSimilarity sets min score of companies reported as similar ones and min score
+// which rejects create in strict mode
+func WithSimilarity(threshold, strict float64) Option {
+	return func(a *api) {
+		a.similarity = similarity{threshold: threshold, strict: strict}
+	}
+}
+
+// SimilarItems returns companies which names look like "name" parameter, best matches first
+func (a *api) SimilarItems(ctx *gin.Context) {
+	name := ctx.Query("name")
+	if name == "" {
+		a.log.Error().Msg("empty similar name")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidName)
+		return
+	}
+	threshold, limit := a.similarity.threshold, defaultSimilarLimit
+	var err error
+	if v := ctx.Query("threshold"); v != "" {
+		threshold, err = strconv.ParseFloat(v, 64)
+		if err != nil || !(threshold >= 0 && threshold <= 1) {
+			a.log.Error().Str("Threshold", v).Msg("invalid similar filter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidFilter)
+			return
+		}
+	}
+	if v := ctx.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSimilarLimit {
+			a.log.Error().Str("Limit", v).Msg("invalid similar filter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidFilter)
+			return
+		}
+	}
+
+	list, err := a.stor.SimilarItems(ctx, name, threshold, limit)
+	if err != nil {
+		a.log.Err(err).Msg("db similar request failed")
+		a.abortWithDBError(ctx, err)
+		return
+	}
+	if list == nil {
+		list = []models.SimilarItem{}
+	}
+	ctx.JSON(http.StatusOK, models.SimilarItemsResponse{Items: list})
+}
+
+// checkSimilar returns similar companies for create response warnings. In strict mode create is rejected
+// if any of them has score above the strict threshold, then false is returned.
+// Without strict mode the check is best effort, its failure doesn't fail create.
+// The check runs before the insert without locks, so concurrent strict creates of similar names could both pass,
+// only equal name keys are rejected by the unique index.
+func (a *api) checkSimilar(ctx *gin.Context, name string) ([]models.SimilarItem, bool) {
+	strict := false
+	if v := ctx.Query("strict"); v != "" {
+		var err error
+		strict, err = strconv.ParseBool(v)
+		if err != nil {
+			a.log.Err(err).Str("Strict", v).Msg("invalid strict parameter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+			return nil, false
+		}
+	}
+
+	list, err := a.stor.SimilarItems(ctx, name, a.similarity.threshold, maxCreateWarnings)
+	if err != nil {
+		a.log.Err(err).Msg("db similar request failed")
+		if strict {
+			a.abortWithDBError(ctx, err)
+			return nil, false
+		}
+		return nil, true
+	}
+	if !strict {
+		return list, true
+	}
+
+	var matches []models.SimilarItem
+	for _, i := range list {
+		if i.Score >= a.similarity.strict {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) > 0 {
+		a.log.Error().Str("Name", name).Msg("similar name exists")
+		ctx.AbortWithStatusJSON(http.StatusConflict, models.ErrorResponse{Error: models.ErrSimilarName.Error(), Matches: matches})
+		return nil, false
+	}
+	return list, true
+}
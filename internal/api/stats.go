@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	defaultStatsTTL = 30 * time.Second
+	maxStatsEntries = 1000
+	maxStatsBuckets = 50
+)
+
+var defaultStatsBuckets = []int{10, 50, 100, 500, 1000}
+
+// WithStatsTTL sets how long stats responses are cached, zero disables caching
+func WithStatsTTL(ttl time.Duration) Option {
+	return func(a *api) {
+		a.stats.ttl = ttl
+	}
+}
+
+type statsEntry struct {
+	stats   *models.ItemStats
+	expires time.Time
+}
+
+// statsCache keeps stats per normalized query string
+type statsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]statsEntry
+}
+
+func (c *statsCache) get(key string, now time.Time) (*statsEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || !now.Before(e.expires) {
+		return nil, false
+	}
+	return &e, true
+}
+
+func (c *statsCache) put(key string, s *models.ItemStats, now time.Time) *statsEntry {
+	e := statsEntry{stats: s, expires: now.Add(c.ttl)}
+	if c.ttl <= 0 {
+		return &e
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil || len(c.entries) >= maxStatsEntries {
+		for k, v := range c.entries {
+			if !now.Before(v.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxStatsEntries || c.entries == nil {
+			c.entries = map[string]statsEntry{}
+		}
+	}
+	c.entries[key] = e
+	return &e
+}
+
+// ItemStats returns aggregated counts and employee count distribution of filtered companies
+func (a *api) ItemStats(ctx *gin.Context) {
+	f, err := parseItemFilter(ctx)
+	if err != nil {
+		a.log.Err(err).Msg("invalid stats filter")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	buckets, err := parseBuckets(ctx.Query("buckets"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid stats buckets")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now()
+	key := ctx.Request.URL.Query().Encode()
+	e, ok := a.stats.get(key, now)
+	if !ok {
+		s, err := a.stor.ItemStats(ctx, f, buckets)
+		if err != nil {
+			a.log.Err(err).Msg("db stats request failed")
+			a.abortWithDBError(ctx, err)
+			return
+		}
+		e = a.stats.put(key, s, now)
+	}
+
+	ctx.Header("Cache-Control", "max-age="+strconv.Itoa(int(e.expires.Sub(now).Seconds())))
+	ctx.JSON(http.StatusOK, e.stats)
+}
+
+// parseBuckets reads comma-separated histogram bounds, they are sorted and deduplicated
+func parseBuckets(v string) ([]int, error) {
+	if v == "" {
+		return defaultStatsBuckets, nil
+	}
+	parts := strings.Split(v, ",")
+	if len(parts) > maxStatsBuckets {
+		return nil, models.ErrInvalidFilter
+	}
+	seen := map[int]struct{}{}
+	var res []int
+	for _, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, models.ErrInvalidFilter
+		}
+		if _, ok := seen[n]; !ok {
+			seen[n] = struct{}{}
+			res = append(res, n)
+		}
+	}
+	sort.Ints(res)
+	return res, nil
+}
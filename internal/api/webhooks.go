@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	defaultDeliveriesLimit = 100
+	maxDeliveriesLimit     = 1000
+)
+
+// WithWebhooks enables webhook subscriptions management endpoints
+func WithWebhooks(webhooks models.WebhookStorageInt) Option {
+	return func(a *api) {
+		a.webhooks = webhooks
+	}
+}
+
+func (a *api) CreateWebhook(ctx *gin.Context) {
+	var req models.WebhookRequest
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		a.log.Err(err).Msg("invalid webhook request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
+	}
+	err = req.Validate()
+	if err != nil {
+		a.log.Err(err).Msg("webhook request validation failed")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	w, err := a.webhooks.CreateWebhook(ctx, &req)
+	if err != nil {
+		a.log.Err(err).Msg("db webhook insert request failed")
+		a.abortWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, w)
+}
+
+func (a *api) ListWebhooks(ctx *gin.Context) {
+	list, err := a.webhooks.ListWebhooks(ctx)
+	if err != nil {
+		a.log.Err(err).Msg("db webhooks select request failed")
+		a.abortWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, list)
+}
+
+func (a *api) GetWebhook(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+
+	w, err := a.webhooks.GetWebhook(ctx, id)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db webhook select request failed")
+		a.abortWebhookError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, w)
+}
+
+// ReplaceWebhook overwrites subscription, it also re-enables disabled webhook unless "enabled" is false
+func (a *api) ReplaceWebhook(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+
+	var req models.WebhookRequest
+	err = ctx.BindJSON(&req)
+	if err != nil {
+		a.log.Err(err).Msg("invalid webhook request")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidRequest)
+		return
+	}
+	err = req.Validate()
+	if err != nil {
+		a.log.Err(err).Msg("webhook request validation failed")
+		a.AbortWithError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	w, err := a.webhooks.ReplaceWebhook(ctx, id, &req)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db webhook update request failed")
+		a.abortWebhookError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, w)
+}
+
+func (a *api) DeleteWebhook(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+
+	err = a.webhooks.DeleteWebhook(ctx, id)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db webhook delete request failed")
+		a.abortWebhookError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns the latest delivery attempts of webhook
+func (a *api) ListWebhookDeliveries(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.log.Err(err).Msg("invalid id")
+		a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidID)
+		return
+	}
+	limit := defaultDeliveriesLimit
+	if v := ctx.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+			a.log.Error().Str("Limit", v).Msg("invalid deliveries filter")
+			a.AbortWithError(ctx, http.StatusBadRequest, models.ErrInvalidFilter)
+			return
+		}
+	}
+
+	_, err = a.webhooks.GetWebhook(ctx, id)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db webhook select request failed")
+		a.abortWebhookError(ctx, err)
+		return
+	}
+	list, err := a.webhooks.ListWebhookDeliveries(ctx, id, limit)
+	if err != nil {
+		a.log.Err(err).Str("ID", id.String()).Msg("db deliveries select request failed")
+		a.abortWithDBError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, list)
+}
+
+func (a *api) abortWebhookError(ctx *gin.Context, err error) {
+	switch err {
+	case models.ErrNotFound:
+		a.AbortWithError(ctx, http.StatusNotFound, models.ErrNotFound)
+	default:
+		a.abortWithDBError(ctx, err)
+	}
+}
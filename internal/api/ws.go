@@ -0,0 +1,283 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	wsWriteWait        = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingPeriod       = wsPongWait * 9 / 10
+	wsMaxMessageSize   = 64 << 10
+	wsMaxSubscriptions = 100
+	// events of subscribed companies waiting to be written, client which falls behind more than this is disconnected
+	wsSendBuffer = 64
+)
+
+const (
+	wsActionSubscribe   = "subscribe"
+	wsActionUnsubscribe = "unsubscribe"
+
+	wsTypeSnapshot = "snapshot"
+	wsTypeEvent    = "event"
+	wsTypeError    = "error"
+
+	// browsers can't set Authorization header on WebSocket connections,
+	// so the token could be passed as "bearer, <token>" list of subprotocols
+	wsProtocolBearer = "bearer"
+)
+
+// Subscribe upgrades the connection to WebSocket, client subscribes to company IDs
+// and receives their current snapshots and change events.
+// Connection is closed when the token expires or the client cannot keep up with events.
+func (a *api) Subscribe(ctx *gin.Context) {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{wsProtocolBearer},
+		CheckOrigin:  a.allowedOrigin,
+	}
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// upgrader has already responded with error
+		a.log.Err(err).Msg("websocket upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	sub := a.events.Subscribe("")
+	defer sub.Cancel()
+
+	// events are filtered as soon as they are published, so only events of subscribed companies
+	// count against the connection buffer, and a busy hub doesn't disconnect quiet subscribers
+	subs := &wsSubscriptions{ids: map[uuid.UUID]struct{}{}}
+	queue := make(chan models.Event, wsSendBuffer)
+	slow := make(chan struct{})
+	go func() {
+		defer close(slow)
+		for e := range sub.C {
+			if !subs.match(&e) {
+				continue
+			}
+			select {
+			case queue <- e:
+			default:
+				return
+			}
+		}
+	}()
+
+	var expired <-chan time.Time
+	if v, ok := ctx.Get(identityKey); ok {
+		if identity := v.(*models.Identity); !identity.ExpiresAt.IsZero() {
+			t := time.NewTimer(time.Until(identity.ExpiresAt))
+			defer t.Stop()
+			expired = t.C
+		}
+	}
+
+	// reader goroutine only decodes commands, all writes happen below
+	reqCtx := ctx.Request.Context()
+	commands := make(chan models.WSRequest)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.SetReadLimit(wsMaxMessageSize)
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			var cmd models.WSRequest
+			err := conn.ReadJSON(&cmd)
+			if err != nil {
+				if _, ok := err.(*websocket.CloseError); !ok {
+					a.log.Err(err).Msg("websocket read failed")
+				}
+				return
+			}
+			select {
+			case commands <- cmd:
+			case <-reqCtx.Done():
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-done:
+			return
+		case <-expired:
+			a.closeWS(conn, websocket.ClosePolicyViolation, "token expired")
+			return
+		case <-ping.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err = conn.WriteMessage(websocket.PingMessage, nil)
+		case cmd := <-commands:
+			err = a.handleWSCommand(ctx, conn, subs, &cmd)
+		case e := <-queue:
+			err = a.writeWSEvent(ctx, conn, &e)
+		case <-slow:
+			a.log.Warn().Msg("websocket client is too slow, closing")
+			a.closeWS(conn, websocket.CloseTryAgainLater, "too slow")
+			return
+		}
+		if err != nil {
+			a.log.Err(err).Msg("websocket write failed")
+			return
+		}
+	}
+}
+
+func (a *api) handleWSCommand(ctx *gin.Context, conn *websocket.Conn, subs *wsSubscriptions, cmd *models.WSRequest) error {
+	switch cmd.Action {
+	case wsActionSubscribe:
+		if !subs.add(cmd.IDs) {
+			return a.writeWS(conn, &models.WSMessage{Type: wsTypeError, Error: models.ErrBatchTooLarge.Error()})
+		}
+		for _, id := range cmd.IDs {
+			msg := models.WSMessage{Type: wsTypeSnapshot, ID: &id}
+			a.setWSItem(ctx, &msg, id)
+			err := a.writeWS(conn, &msg)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case wsActionUnsubscribe:
+		subs.remove(cmd.IDs)
+		return nil
+	}
+	return a.writeWS(conn, &models.WSMessage{Type: wsTypeError, Error: models.ErrInvalidOperation.Error()})
+}
+
+// writeWSEvent sends event together with the current item state, deleted items have no state
+func (a *api) writeWSEvent(ctx *gin.Context, conn *websocket.Conn, e *models.Event) error {
+	msg := models.WSMessage{
+		Type:       wsTypeEvent,
+		ID:         &e.Data.ID,
+		Event:      e.Data.Event,
+		Timestamp:  e.Data.Timestamp,
+		MergedFrom: e.Data.MergedFrom,
+	}
+	if e.Data.Event != models.EventTypeDeleted {
+		a.setWSItem(ctx, &msg, e.Data.ID)
+	}
+	return a.writeWS(conn, &msg)
+}
+
+// wsSubscriptions is the set of company IDs of one connection, shared by the writer and the event filter
+type wsSubscriptions struct {
+	mu  sync.Mutex
+	ids map[uuid.UUID]struct{}
+}
+
+// add returns false if the connection would exceed wsMaxSubscriptions, nothing is added then
+func (s *wsSubscriptions) add(ids []uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := 0
+	for _, id := range ids {
+		if _, ok := s.ids[id]; !ok {
+			added++
+		}
+	}
+	if len(s.ids)+added > wsMaxSubscriptions {
+		return false
+	}
+	for _, id := range ids {
+		s.ids[id] = struct{}{}
+	}
+	return true
+}
+
+func (s *wsSubscriptions) remove(ids []uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.ids, id)
+	}
+}
+
+// match is true if event is about one of subscribed companies, merged event is also about the merged company
+func (s *wsSubscriptions) match(e *models.Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[e.Data.ID]; ok {
+		return true
+	}
+	if e.Data.MergedFrom != nil {
+		_, ok := s.ids[*e.Data.MergedFrom]
+		return ok
+	}
+	return false
+}
+
+// allowedOrigin checks WebSocket handshake against the CORS allow-list, same-origin pages
+// and clients which are not browsers and send no Origin are always allowed
+func (a *api) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range a.allowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns token from Authorization header or, for WebSocket handshake, from subprotocols
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		return parts[1], true
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		protocols := websocket.Subprotocols(r)
+		if len(protocols) == 2 && protocols[0] == wsProtocolBearer {
+			return protocols[1], true
+		}
+	}
+	return "", false
+}
+
+func (a *api) setWSItem(ctx *gin.Context, msg *models.WSMessage, id uuid.UUID) {
+	item, err := a.stor.GetItem(ctx, id)
+	switch err {
+	case nil:
+		msg.Item = item
+	case models.ErrNotFound:
+		msg.Error = models.ErrNotFound.Error()
+	default:
+		a.log.Err(err).Str("ID", id.String()).Msg("db select request failed")
+		_, err = dbError(err)
+		msg.Error = err.Error()
+	}
+}
+
+func (a *api) writeWS(conn *websocket.Conn, msg *models.WSMessage) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	return conn.WriteJSON(msg)
+}
+
+func (a *api) closeWS(conn *websocket.Conn, code int, text string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+}
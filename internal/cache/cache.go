@@ -0,0 +1,393 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	defaultSize        = 10000
+	defaultTTL         = time.Minute
+	defaultNegativeTTL = 5 * time.Second
+)
+
+type entry struct {
+	id uuid.UUID
+	// nil item is a cached ErrNotFound
+	item    *models.ItemResponse
+	expires time.Time
+}
+
+// cache is a read-through cache of companies in front of another storage.
+// Single items are cached, every write through the cache invalidates affected items,
+// writes done by other instances are applied with Invalidate.
+// loading tracks loads of one item in flight, version is incremented when the item is invalidated,
+// so a load is stored only if its own item was not invalidated while it was read
+type loading struct {
+	version uint64
+	n       int
+}
+
+type cache struct {
+	models.StorageInt
+
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[uuid.UUID]*list.Element
+	loads map[uuid.UUID]*loading
+
+	hits, misses, negativeHits, evictions, invalidations atomic.Uint64
+}
+
+type Option func(c *cache)
+
+// WithSize sets max number of cached items, least recently used ones are evicted
+func WithSize(n int) Option {
+	return func(c *cache) {
+		c.size = n
+	}
+}
+
+// WithTTL sets how long found items are cached
+func WithTTL(ttl time.Duration) Option {
+	return func(c *cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithNegativeTTL sets how long not found items are cached, it should be short,
+// since an item could be created with the client-provided ID by another instance
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *cache) {
+		c.negativeTTL = ttl
+	}
+}
+
+func New(next models.StorageInt, opts ...Option) *cache {
+	c := &cache{
+		StorageInt:  next,
+		size:        defaultSize,
+		ttl:         defaultTTL,
+		negativeTTL: defaultNegativeTTL,
+		lru:         list.New(),
+		items:       map[uuid.UUID]*list.Element{},
+		loads:       map[uuid.UUID]*loading{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// GetItem returns cached item, requests with read-your-writes consistency bypass the cache
+func (c *cache) GetItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	if !models.ReadPrimary(ctx) {
+		if e, ok := c.get(id, time.Now()); ok {
+			if e.item == nil {
+				return nil, models.ErrNotFound
+			}
+			item := *e.item
+			return &item, nil
+		}
+	}
+
+	version := c.startLoad(id)
+	defer c.endLoad(id)
+	item, err := c.StorageInt.GetItem(ctx, id)
+	switch {
+	case err == nil:
+		cached := *item
+		c.put(version, id, &cached)
+	case errors.Is(err, models.ErrNotFound):
+		c.put(version, id, nil)
+	}
+	return item, err
+}
+
+// GetItems returns cached items and reads the rest from storage in one request
+func (c *cache) GetItems(ctx context.Context, ids []uuid.UUID) ([]models.ItemResponse, error) {
+	if models.ReadPrimary(ctx) {
+		return c.StorageInt.GetItems(ctx, ids)
+	}
+
+	now := time.Now()
+	res := make([]models.ItemResponse, 0, len(ids))
+	var missing []uuid.UUID
+	for _, id := range ids {
+		e, ok := c.get(id, now)
+		switch {
+		case !ok:
+			missing = append(missing, id)
+		case e.item != nil:
+			res = append(res, *e.item)
+		}
+	}
+	if len(missing) == 0 {
+		return res, nil
+	}
+
+	versions := make(map[uuid.UUID]uint64, len(missing))
+	for _, id := range missing {
+		versions[id] = c.startLoad(id)
+	}
+	defer func() {
+		for _, id := range missing {
+			c.endLoad(id)
+		}
+	}()
+	items, err := c.StorageInt.GetItems(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[uuid.UUID]struct{}, len(items))
+	for n := range items {
+		cached := items[n]
+		c.put(versions[cached.ID], cached.ID, &cached)
+		found[cached.ID] = struct{}{}
+	}
+	for _, id := range missing {
+		if _, ok := found[id]; !ok {
+			c.put(versions[id], id, nil)
+		}
+	}
+	return append(res, items...), nil
+}
+
+func (c *cache) CreateItem(ctx context.Context, i *models.ItemCreateRequest) (*uuid.UUID, error) {
+	id, err := c.StorageInt.CreateItem(ctx, i)
+	if id != nil {
+		c.Invalidate(*id)
+	}
+	return id, err
+}
+
+func (c *cache) CreateItemWithID(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest) (bool, error) {
+	defer c.Invalidate(id)
+	return c.StorageInt.CreateItemWithID(ctx, id, i)
+}
+
+// write methods invalidate the item even on error, the change could be committed anyway
+
+func (c *cache) UpdateItem(ctx context.Context, id uuid.UUID, i *models.ItemUpdateRequest) (*models.ItemResponse, error) {
+	defer c.Invalidate(id)
+	return c.StorageInt.UpdateItem(ctx, id, i)
+}
+
+func (c *cache) ReplaceItem(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest, upsert bool) (bool, error) {
+	defer c.Invalidate(id)
+	return c.StorageInt.ReplaceItem(ctx, id, i, upsert)
+}
+
+func (c *cache) DeleteItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	defer c.Invalidate(id)
+	return c.StorageInt.DeleteItem(ctx, id)
+}
+
+func (c *cache) ApplyBatch(ctx context.Context, items []models.BatchItem, atomic bool) ([]models.BatchItemResult, error) {
+	res, err := c.StorageInt.ApplyBatch(ctx, items, atomic)
+	for n := range items {
+		if items[n].ID != uuid.Nil {
+			c.Invalidate(items[n].ID)
+		}
+	}
+	for n := range res {
+		if res[n].Item != nil {
+			c.Invalidate(res[n].Item.ID)
+		}
+	}
+	return res, err
+}
+
+func (c *cache) MergeItem(ctx context.Context, id, into uuid.UUID) (*models.ItemResponse, error) {
+	defer c.Invalidate(id)
+	return c.StorageInt.MergeItem(ctx, id, into)
+}
+
+// WithTx runs fn on uncached transactional storage, items written by fn are invalidated
+// when the transaction is over, committed or not
+func (c *cache) WithTx(ctx context.Context, fn func(tx models.StorageInt) error) error {
+	w := &txWrites{}
+	defer func() {
+		for _, id := range w.ids {
+			c.Invalidate(id)
+		}
+	}()
+	return c.StorageInt.WithTx(ctx, func(tx models.StorageInt) error {
+		w.StorageInt = tx
+		return fn(w)
+	})
+}
+
+// txWrites records ids of items written in a transaction
+type txWrites struct {
+	models.StorageInt
+	ids []uuid.UUID
+}
+
+func (w *txWrites) CreateItem(ctx context.Context, i *models.ItemCreateRequest) (*uuid.UUID, error) {
+	id, err := w.StorageInt.CreateItem(ctx, i)
+	if id != nil {
+		w.ids = append(w.ids, *id)
+	}
+	return id, err
+}
+
+func (w *txWrites) CreateItemWithID(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest) (bool, error) {
+	w.ids = append(w.ids, id)
+	return w.StorageInt.CreateItemWithID(ctx, id, i)
+}
+
+func (w *txWrites) UpdateItem(ctx context.Context, id uuid.UUID, i *models.ItemUpdateRequest) (*models.ItemResponse, error) {
+	w.ids = append(w.ids, id)
+	return w.StorageInt.UpdateItem(ctx, id, i)
+}
+
+func (w *txWrites) ReplaceItem(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest, upsert bool) (bool, error) {
+	w.ids = append(w.ids, id)
+	return w.StorageInt.ReplaceItem(ctx, id, i, upsert)
+}
+
+func (w *txWrites) DeleteItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	w.ids = append(w.ids, id)
+	return w.StorageInt.DeleteItem(ctx, id)
+}
+
+func (w *txWrites) MergeItem(ctx context.Context, id, into uuid.UUID) (*models.ItemResponse, error) {
+	w.ids = append(w.ids, id)
+	return w.StorageInt.MergeItem(ctx, id, into)
+}
+
+func (w *txWrites) ApplyBatch(ctx context.Context, items []models.BatchItem, atomic bool) ([]models.BatchItemResult, error) {
+	res, err := w.StorageInt.ApplyBatch(ctx, items, atomic)
+	for n := range items {
+		if items[n].ID != uuid.Nil {
+			w.ids = append(w.ids, items[n].ID)
+		}
+	}
+	for n := range res {
+		if res[n].Item != nil {
+			w.ids = append(w.ids, res[n].Item.ID)
+		}
+	}
+	return res, err
+}
+
+// Invalidate drops cached item, it's called on writes and on change events from other instances
+func (c *cache) Invalidate(id uuid.UUID) {
+	c.invalidations.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.loads[id]; ok {
+		l.version++
+	}
+	if el, ok := c.items[id]; ok {
+		c.lru.Remove(el)
+		delete(c.items, id)
+	}
+}
+
+// Stats returns cache counters since start
+func (c *cache) Stats() models.CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return models.CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		NegativeHits:  c.negativeHits.Load(),
+		Evictions:     c.evictions.Load(),
+		Invalidations: c.invalidations.Load(),
+		Size:          size,
+	}
+}
+
+func (c *cache) get(id uuid.UUID, now time.Time) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[id]
+	if !ok {
+		c.misses.Add(1)
+		return entry{}, false
+	}
+	e := el.Value.(*entry)
+	if !now.Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.items, id)
+		c.misses.Add(1)
+		return entry{}, false
+	}
+	c.lru.MoveToFront(el)
+	if e.item == nil {
+		c.negativeHits.Add(1)
+	} else {
+		c.hits.Add(1)
+	}
+	return *e, true
+}
+
+// startLoad registers load of the item and returns its version to be passed to put
+func (c *cache) startLoad(id uuid.UUID) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.loads[id]
+	if !ok {
+		l = &loading{}
+		c.loads[id] = l
+	}
+	l.n++
+	return l.version
+}
+
+// endLoad must be called for every startLoad after put
+func (c *cache) endLoad(id uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l := c.loads[id]
+	l.n--
+	if l.n == 0 {
+		delete(c.loads, id)
+	}
+}
+
+// put stores loaded item unless it was invalidated since the load started,
+// otherwise a slow read could put back the state which was just overwritten
+func (c *cache) put(version uint64, id uuid.UUID, item *models.ItemResponse) {
+	ttl := c.ttl
+	if item == nil {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 || c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.loads[id]; !ok || l.version != version {
+		return
+	}
+	e := &entry{id: id, item: item, expires: time.Now().Add(ttl)}
+	if el, ok := c.items[id]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.items[id] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.items, el.Value.(*entry).id)
+		c.evictions.Add(1)
+	}
+}
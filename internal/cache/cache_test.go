@@ -0,0 +1,96 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mannulus-immortalis/xmtask/internal/cache"
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+	"github.com/mannulus-immortalis/xmtask/internal/models/mocks"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("success_invalidate", func(t *testing.T) {
+		ctx := context.Background()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		employeeCount := 4
+
+		// mock db, the second read is served from cache, the read after update goes to storage
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("GetItem", mock.Anything, id).
+			Return(&models.ItemResponse{ID: id, Name: "name", EmployeeCount: 3, Type: "Corporations"}, nil).Once()
+		dbConn.On("UpdateItem", mock.Anything, id, mock.Anything).
+			Return(&models.ItemResponse{ID: id, Name: "name", EmployeeCount: 4, Type: "Corporations"}, nil).Once()
+		dbConn.On("GetItem", mock.Anything, id).
+			Return(&models.ItemResponse{ID: id, Name: "name", EmployeeCount: 4, Type: "Corporations"}, nil).Once()
+		cached := cache.New(dbConn)
+
+		// read, update and read again
+		for range 2 {
+			item, err := cached.GetItem(ctx, id)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, item.EmployeeCount)
+		}
+		_, err := cached.UpdateItem(ctx, id, &models.ItemUpdateRequest{EmployeeCount: &employeeCount})
+		assert.NoError(t, err)
+		item, err := cached.GetItem(ctx, id)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, 4, item.EmployeeCount)
+		assert.Equal(t, models.CacheStats{Hits: 1, Misses: 2, Invalidations: 1, Size: 1}, cached.Stats())
+	})
+
+	t.Run("success_concurrent_invalidate", func(t *testing.T) {
+		ctx := context.Background()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		other := uuid.MustParse("9a2f5c1e-0b7d-4c3e-8f6a-1d2e3f4a5b6c")
+
+		// mock db, invalidation of another item during the load doesn't prevent caching,
+		// the item invalidated during its own load is read again
+		dbConn := mocks.NewStorageInt(t)
+		cached := cache.New(dbConn)
+		dbConn.On("GetItem", mock.Anything, id).
+			Run(func(mock.Arguments) { cached.Invalidate(other) }).
+			Return(&models.ItemResponse{ID: id, Name: "name", EmployeeCount: 3, Type: "Corporations"}, nil).Once()
+		dbConn.On("GetItem", mock.Anything, other).
+			Run(func(mock.Arguments) { cached.Invalidate(other) }).
+			Return(&models.ItemResponse{ID: other, Name: "other", EmployeeCount: 5, Type: "Corporations"}, nil).Twice()
+
+		// read every item twice
+		for _, itemID := range []uuid.UUID{id, id, other, other} {
+			item, err := cached.GetItem(ctx, itemID)
+
+			// test result
+			assert.NoError(t, err)
+			assert.Equal(t, itemID, item.ID)
+		}
+	})
+
+	t.Run("success_negative_ttl", func(t *testing.T) {
+		ctx := context.Background()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock db, not found is cached until negative TTL is over
+		dbConn := mocks.NewStorageInt(t)
+		dbConn.On("GetItem", mock.Anything, id).Return(nil, models.ErrNotFound).Twice()
+		cached := cache.New(dbConn, cache.WithNegativeTTL(100*time.Millisecond))
+
+		// read three times, the last one after TTL
+		for n := range 3 {
+			if n == 2 {
+				time.Sleep(150 * time.Millisecond)
+			}
+			_, err := cached.GetItem(ctx, id)
+
+			// test result
+			assert.ErrorIs(t, err, models.ErrNotFound)
+		}
+		assert.Equal(t, uint64(1), cached.Stats().NegativeHits)
+	})
+}
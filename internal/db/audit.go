@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const defaultAuditLimit = 100
+
+// AddAuditRecords writes all records of one request with a single statement
+func (c *db) AddAuditRecords(ctx context.Context, list []models.AuditRecord) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		values []string
+		args   []interface{}
+	)
+	for _, r := range list {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7))
+		args = append(args, r.Method, r.Route, r.CompanyID, r.Principal, r.Status, r.ClientIP, r.RequestID)
+	}
+	query := `INSERT INTO audit_log (method, route, company_id, principal, status, client_ip, request_id)
+	VALUES ` + strings.Join(values, ", ")
+
+	_, err := c.q.ExecContext(ctx, query, args...)
+	return timeoutError(err)
+}
+
+func (c *db) ListAuditRecords(ctx context.Context, f *models.AuditFilter) ([]models.AuditRecord, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if f.CompanyID != "" {
+		args = append(args, f.CompanyID)
+		where = append(where, "company_id = $"+strconv.Itoa(len(args)))
+	}
+	if f.Principal != "" {
+		args = append(args, f.Principal)
+		where = append(where, "principal = $"+strconv.Itoa(len(args)))
+	}
+	if f.From != nil {
+		args = append(args, *f.From)
+		where = append(where, "created_at >= $"+strconv.Itoa(len(args)))
+	}
+	if f.To != nil {
+		args = append(args, *f.To)
+		where = append(where, "created_at < $"+strconv.Itoa(len(args)))
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	args = append(args, limit)
+
+	query := `SELECT id, created_at, method, route, company_id, principal, status, client_ip, request_id FROM audit_log`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := c.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	defer rows.Close()
+
+	list := []models.AuditRecord{}
+	for rows.Next() {
+		var r models.AuditRecord
+		err = rows.Scan(&r.ID, &r.CreatedAt, &r.Method, &r.Route, &r.CompanyID, &r.Principal, &r.Status, &r.ClientIP, &r.RequestID)
+		if err != nil {
+			return nil, timeoutError(err)
+		}
+		list = append(list, r)
+	}
+	return list, timeoutError(rows.Err())
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// ApplyBatch executes batch items one by one. In atomic mode all items share one transaction,
+// which is rolled back on the first failure, and the rest of items are reported as aborted.
+// Transaction rolled back because of transient error is retried as a whole.
+// Inside WithTx the batch is always atomic, since a failed statement aborts the outer transaction.
+// Storage timeout applies to every item separately, in atomic mode to every attempt of the whole transaction.
+func (c *db) ApplyBatch(ctx context.Context, items []models.BatchItem, atomic bool) ([]models.BatchItemResult, error) {
+	if c.inTransaction() {
+		return c.applyBatchItems(ctx, items, true), nil
+	}
+	if !atomic {
+		return c.applyBatchItems(ctx, items, false), nil
+	}
+
+	var res []models.BatchItemResult
+	err := c.retry(ctx, func(int) (err error) {
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		res, err = c.applyAtomicBatch(ctx, items)
+		return err
+	})
+	if res == nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// applyAtomicBatch returns results along with transient error which caused rollback
+func (c *db) applyAtomicBatch(ctx context.Context, items []models.BatchItem) ([]models.BatchItemResult, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := c.inTx(tx).applyBatchItems(ctx, items, true)
+	for _, r := range res {
+		if r.Err != nil {
+			_ = tx.Rollback()
+			if errIsTransient(r.Err) {
+				return res, r.Err
+			}
+			return res, nil
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, &commitError{err: err}
+	}
+	return res, nil
+}
+
+func (c *db) applyBatchItems(ctx context.Context, items []models.BatchItem, stopOnError bool) []models.BatchItemResult {
+	res := make([]models.BatchItemResult, len(items))
+	for n := range items {
+		res[n] = c.applyBatchItem(ctx, &items[n])
+		if res[n].Err != nil && stopOnError {
+			for k := range res {
+				if k != n {
+					res[k] = models.BatchItemResult{Err: models.ErrBatchAborted}
+				}
+			}
+			break
+		}
+	}
+	return res
+}
+
+func (c *db) applyBatchItem(ctx context.Context, item *models.BatchItem) models.BatchItemResult {
+	switch item.Op {
+	case models.BatchOpCreate:
+		id, err := c.CreateItem(ctx, item.Create)
+		if err != nil {
+			return models.BatchItemResult{Err: err}
+		}
+		return models.BatchItemResult{Item: &models.ItemResponse{
+			ID:            *id,
+			Name:          item.Create.Name,
+			Description:   item.Create.Description,
+			EmployeeCount: item.Create.EmployeeCount,
+			IsRegistered:  item.Create.IsRegistered,
+			Type:          item.Create.Type,
+		}}
+	case models.BatchOpUpdate:
+		i, err := c.UpdateItem(ctx, item.ID, item.Update)
+		return models.BatchItemResult{Item: i, Err: err}
+	case models.BatchOpDelete:
+		i, err := c.DeleteItem(ctx, item.ID)
+		return models.BatchItemResult{Item: i, Err: err}
+	}
+	return models.BatchItemResult{Err: models.ErrInvalidOperation}
+}
@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -10,102 +12,490 @@ import (
 	"github.com/mannulus-immortalis/xmtask/internal/models"
 )
 
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type dialect int
+
+const (
+	dialectPostgres dialect = iota
+	dialectSQLite
+)
+
 type db struct {
-	db *sql.DB
+	db       *sql.DB
+	q        querier
+	dialect  dialect
+	replicas *replicaSet
+	timeout  time.Duration
+
+	retryAttempts int
+	retryBackoff  time.Duration
+	stripSuffixes bool
+}
+
+type Option func(c *config)
+
+type config struct {
+	replicas            []string
+	healthCheckInterval time.Duration
+	pool                pool
+	timeout             time.Duration
+	retryAttempts       int
+	retryBackoff        time.Duration
+	stripSuffixes       bool
+}
+
+func defaultConfig() config {
+	return config{
+		healthCheckInterval: defaultHealthCheckInterval,
+		retryAttempts:       defaultRetryAttempts,
+		retryBackoff:        defaultRetryBackoff,
+	}
 }
 
-func New(connStr string) (*db, error) {
-	dbConn, err := sql.Open("postgres", connStr)
+func New(connStr string, opts ...Option) (*db, error) {
+	conf := defaultConfig()
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	dbConn, err := openPostgres(connStr, &conf)
 	if err != nil {
 		return nil, err
 	}
 	err = dbConn.Ping()
 	if err != nil {
+		dbConn.Close()
 		return nil, err
 	}
-	return &db{db: dbConn}, nil
+	replicas := make([]*sql.DB, 0, len(conf.replicas))
+	for _, dsn := range conf.replicas {
+		r, err := openPostgres(dsn, &conf)
+		if err != nil {
+			dbConn.Close()
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, err
+		}
+		replicas = append(replicas, r)
+	}
+	c := newDB(dbConn, replicas, &conf)
+	err = c.fillNameKeys(context.Background())
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewFromConn wraps existing connections, reads are sent to replicas if there are any
+func NewFromConn(dbConn *sql.DB, replicas ...*sql.DB) *db {
+	conf := defaultConfig()
+	return newDB(dbConn, replicas, &conf)
+}
+
+func newDB(dbConn *sql.DB, replicas []*sql.DB, conf *config) *db {
+	c := &db{
+		db:            dbConn,
+		q:             dbConn,
+		timeout:       conf.timeout,
+		retryAttempts: conf.retryAttempts,
+		retryBackoff:  conf.retryBackoff,
+		stripSuffixes: conf.stripSuffixes,
+	}
+	if len(replicas) > 0 {
+		c.replicas = newReplicaSet(replicas, conf.healthCheckInterval)
+	}
+	return c
 }
 
-func NewFromConn(dbConn *sql.DB) *db {
-	return &db{db: dbConn}
+// inTx returns copy of c which runs queries in transaction
+func (c *db) inTx(tx *sql.Tx) *db {
+	txConn := *c
+	txConn.q = tx
+	return &txConn
 }
 
+// CreateItem generates id on client side, so after a lost response the retry finds the row
+// inserted by the previous attempt instead of creating a duplicate
 func (c *db) CreateItem(ctx context.Context, i *models.ItemCreateRequest) (*uuid.UUID, error) {
-	query := `INSERT INTO companies (name, description, employee_count, is_registered, legal_type)
-	VALUES ($1, $2, $3, $4, $5)
+	id, _, err := c.createItem(ctx, uuid.New(), i)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// CreateItemWithID returns false if the item with the id already exists, it's left unchanged then
+func (c *db) CreateItemWithID(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest) (bool, error) {
+	_, created, err := c.createItem(ctx, id, i)
+	return created, err
+}
+
+func (c *db) createItem(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest) (uuid.UUID, bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO companies (id, name, description, employee_count, is_registered, legal_type, name_key)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id) DO NOTHING
 	RETURNING id`
 
-	var id uuid.UUID
-	err := c.db.QueryRowContext(ctx, query, i.Name, i.Description, i.EmployeeCount, i.IsRegistered, i.Type).Scan(&id)
+	key := c.nameKey(i.Name)
+	created := true
+	err := c.retry(ctx, func(attempt int) error {
+		err := c.q.QueryRowContext(ctx, query, id.String(), i.Name, i.Description, i.EmployeeCount, i.IsRegistered, i.Type, key).Scan(&id)
+		if err == sql.ErrNoRows {
+			// on retry the row could be inserted by the previous attempt
+			created = attempt > 1
+			return nil
+		}
+		return err
+	})
 	if err != nil && errIsDuplicate(err) {
-		return nil, models.ErrDuplicateName
+		return id, false, c.duplicateNameError(ctx, key)
+	}
+	if err != nil {
+		return id, false, err
 	}
-	return &id, err
+	return id, created, nil
 }
 
-func (c *db) UpdateItem(ctx context.Context, id uuid.UUID, i *models.ItemUpdateRequest) error {
+func (c *db) UpdateItem(ctx context.Context, id uuid.UUID, i *models.ItemUpdateRequest) (*models.ItemResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	query := `UPDATE companies 
 	SET
 		name=COALESCE($2, name), 
 		description=COALESCE($3, description), 
 		employee_count=COALESCE($4, employee_count), 
 		is_registered=COALESCE($5, is_registered), 
-		legal_type=COALESCE($6, legal_type)
-	WHERE id = $1`
+		legal_type=COALESCE($6, legal_type),
+		name_key=COALESCE($7, name_key)
+	WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`
 
-	res, err := c.db.ExecContext(ctx, query, id.String(), i.Name, i.Description, i.EmployeeCount, i.IsRegistered, i.Type)
+	var key *string
+	if i.Name != nil {
+		k := c.nameKey(*i.Name)
+		key = &k
+	}
+	// a repeated update could overwrite a concurrent change and record it as one more revision,
+	// so only errors which guarantee that the previous attempt had no effect are retried
+	var res models.ItemResponse
+	err := c.retryOn(ctx, errIsUncommitted, func(int) error {
+		return c.q.QueryRowContext(ctx, query, id.String(), i.Name, i.Description, i.EmployeeCount, i.IsRegistered, i.Type, key).
+			Scan(&res.ID, &res.Name, &res.Description, &res.EmployeeCount, &res.IsRegistered, &res.Type)
+	})
 	if err != nil && errIsDuplicate(err) {
-		return models.ErrDuplicateName
+		if key == nil {
+			return nil, models.ErrDuplicateName
+		}
+		return nil, c.duplicateNameError(ctx, *key)
 	}
-	if err != nil {
-		return err
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
 	}
-	cnt, err := res.RowsAffected()
 	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ReplaceItem overwrites all fields of the item. With upsert the item is created if it does not exist,
+// returned flag reports whether it was created.
+func (c *db) ReplaceItem(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest, upsert bool) (bool, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	// retried only when the previous attempt had no effect, as update
+	var created bool
+	err := c.retryOn(ctx, errIsUncommitted, func(int) (err error) {
+		created, err = c.replaceItem(ctx, id, i, upsert)
 		return err
+	})
+	return created, err
+}
+
+func (c *db) replaceItem(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest, upsert bool) (bool, error) {
+	if !upsert {
+		query := `UPDATE companies
+	SET name=$2, description=$3, employee_count=$4, is_registered=$5, legal_type=$6, name_key=$7
+	WHERE id = $1`
+
+		key := c.nameKey(i.Name)
+		res, err := c.q.ExecContext(ctx, query, id.String(), i.Name, i.Description, i.EmployeeCount, i.IsRegistered, i.Type, key)
+		if err != nil && errIsDuplicate(err) {
+			return false, c.duplicateNameError(ctx, key)
+		}
+		if err != nil {
+			return false, err
+		}
+		cnt, err := res.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if cnt == 0 {
+			return false, models.ErrNotFound
+		}
+		return false, nil
 	}
-	if cnt == 0 {
-		return models.ErrNotFound
+	if c.dialect == dialectSQLite {
+		// there is no xmax in SQLite to tell insert from update, so try to update first
+		_, err := c.replaceItem(ctx, id, i, false)
+		if err != models.ErrNotFound {
+			return false, err
+		}
+		return true, c.insertItem(ctx, id, i)
 	}
 
-	return err
+	query := `INSERT INTO companies (id, name, description, employee_count, is_registered, legal_type, name_key)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (id) DO UPDATE
+	SET name=EXCLUDED.name, description=EXCLUDED.description, employee_count=EXCLUDED.employee_count,
+		is_registered=EXCLUDED.is_registered, legal_type=EXCLUDED.legal_type, name_key=EXCLUDED.name_key
+	RETURNING (xmax = 0) AS created`
+
+	var created bool
+	key := c.nameKey(i.Name)
+	err := c.q.QueryRowContext(ctx, query, id.String(), i.Name, i.Description, i.EmployeeCount, i.IsRegistered, i.Type, key).Scan(&created)
+	if err != nil && errIsDuplicate(err) {
+		return false, c.duplicateNameError(ctx, key)
+	}
+	return created, err
 }
 
-func (c *db) DeleteItem(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM companies WHERE id = $1`
+func (c *db) DeleteItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
 
-	res, err := c.db.ExecContext(ctx, query, id.String())
-	if err != nil {
-		return err
+	query := `DELETE FROM companies WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`
+
+	var res models.ItemResponse
+	err := c.q.QueryRowContext(ctx, query, id.String()).
+		Scan(&res.ID, &res.Name, &res.Description, &res.EmployeeCount, &res.IsRegistered, &res.Type)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
 	}
-	cnt, err := res.RowsAffected()
 	if err != nil {
-		return err
-	}
-	if cnt == 0 {
-		return models.ErrNotFound
+		return nil, timeoutError(err)
 	}
-	return nil
+	return &res, nil
 }
 
 func (c *db) GetItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	query := `SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`
 
 	var i models.ItemResponse
-	err := c.db.QueryRowContext(ctx, query, id.String()).Scan(&i.ID, &i.Name, &i.Description, &i.EmployeeCount, &i.IsRegistered, &i.Type)
+	err := c.read(ctx, func(q querier) error {
+		return q.QueryRowContext(ctx, query, id.String()).Scan(&i.ID, &i.Name, &i.Description, &i.EmployeeCount, &i.IsRegistered, &i.Type)
+	})
 	if err == sql.ErrNoRows {
 		return nil, models.ErrNotFound
 	}
 	return &i, err
 }
 
+// LockItem reads the item from the primary, in a transaction its row stays locked until commit or rollback,
+// so the item could be written based on the read state. SQLite has no row locks, but a single writer.
+func (c *db) LockItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = $1`
+	if c.dialect == dialectPostgres {
+		query += ` FOR UPDATE`
+	}
+
+	var i models.ItemResponse
+	err := c.q.QueryRowContext(ctx, query, id.String()).Scan(&i.ID, &i.Name, &i.Description, &i.EmployeeCount, &i.IsRegistered, &i.Type)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	return &i, nil
+}
+
+// GetItems returns all found items in unspecified order
+func (c *db) GetItems(ctx context.Context, ids []uuid.UUID) ([]models.ItemResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id = ANY($1)`
+
+	list := make([]string, len(ids))
+	for n := range ids {
+		list[n] = ids[n].String()
+	}
+	args := []interface{}{pq.Array(list)}
+	if c.dialect == dialectSQLite {
+		query, args = sqliteGetItemsQuery(list)
+	}
+	var res []models.ItemResponse
+	err := c.read(ctx, func(q querier) error {
+		res = nil
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var i models.ItemResponse
+			err = rows.Scan(&i.ID, &i.Name, &i.Description, &i.EmployeeCount, &i.IsRegistered, &i.Type)
+			if err != nil {
+				return err
+			}
+			res = append(res, i)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *db) ListRevisions(ctx context.Context, id uuid.UUID) ([]models.ItemRevision, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT revision, event, data, created_at FROM company_revisions WHERE company_id = $1 ORDER BY revision`
+
+	var list []models.ItemRevision
+	err := c.read(ctx, func(q querier) error {
+		list = nil
+		rows, err := q.QueryContext(ctx, query, id.String())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			r, err := scanRevision(rows)
+			if err != nil {
+				return err
+			}
+			list = append(list, *r)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, models.ErrNotFound
+	}
+	return list, nil
+}
+
+func (c *db) GetRevision(ctx context.Context, id uuid.UUID, revision int) (*models.ItemRevision, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT revision, event, data, created_at FROM company_revisions WHERE company_id = $1 AND revision = $2`
+
+	var r *models.ItemRevision
+	err := c.read(ctx, func(q querier) (err error) {
+		r, err = scanRevision(q.QueryRowContext(ctx, query, id.String(), revision))
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	return r, err
+}
+
+// ListChanges returns revisions of all companies with sequence number greater than since
+func (c *db) ListChanges(ctx context.Context, since int64, limit int) ([]models.Change, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT seq, company_id, revision, event, data, created_at FROM company_revisions WHERE seq > $1 ORDER BY seq LIMIT $2`
+
+	var list []models.Change
+	err := c.read(ctx, func(q querier) error {
+		list = []models.Change{}
+		rows, err := q.QueryContext(ctx, query, since, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				ch   models.Change
+				data []byte
+			)
+			err = rows.Scan(&ch.Seq, &ch.ID, &ch.Revision, &ch.Event, &data, &ch.CreatedAt)
+			if err != nil {
+				return err
+			}
+			err = json.Unmarshal(data, &ch.Item)
+			if err != nil {
+				return err
+			}
+			list = append(list, ch)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
 func (c *db) Close() {
+	if c.replicas != nil {
+		c.replicas.close()
+	}
 	c.db.Close()
 }
 
+// nameConstraints enforce unique company names, companies_name_key is the one before migrations/0001_name_key.sql
+var nameConstraints = map[string]bool{
+	"companies_name_key_uniq": true,
+	"companies_name_key":      true,
+}
+
+// errIsDuplicate is true only for violation of company name uniqueness, other unique violations,
+// like a revision number taken by a concurrent write, are plain DB errors
 func errIsDuplicate(err error) bool {
 	if pgerr, ok := err.(*pq.Error); ok {
-		return pgerr.Code == "23505"
+		return pgerr.Code == "23505" && nameConstraints[pgerr.Constraint]
+	}
+	return sqliteErrIsDuplicate(err)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRevision(row scanner) (*models.ItemRevision, error) {
+	var (
+		r    models.ItemRevision
+		data []byte
+	)
+	err := row.Scan(&r.Revision, &r.Event, &data, &r.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &r.Item)
+	if err != nil {
+		return nil, err
 	}
-	return false
+	return &r, nil
 }
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const exportFetchSize = 500
+
+// ExportItems reads filtered companies with server-side cursor and passes them to fn one by one
+func (c *db) ExportItems(ctx context.Context, f *models.ItemFilter, fn func(i *models.ItemResponse) error) error {
+	if c.dialect == dialectSQLite {
+		return c.sqliteExportItems(ctx, f, fn)
+	}
+	where, args := c.itemFilterWhere(f)
+
+	return c.readTx(ctx, &sql.TxOptions{ReadOnly: true}, func(q querier) error {
+		query := `DECLARE export_cursor NO SCROLL CURSOR FOR
+		SELECT id, name, description, employee_count, is_registered, legal_type FROM companies` + where + ` ORDER BY id`
+		_, err := q.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		// own transaction drops the cursor on rollback, the outer one could run another export
+		if c.inTransaction() {
+			defer func() {
+				_, _ = q.ExecContext(ctx, `CLOSE export_cursor`)
+			}()
+		}
+
+		for {
+			cnt, err := fetchExportRows(ctx, q, fn)
+			if err != nil {
+				return err
+			}
+			if cnt < exportFetchSize {
+				return nil
+			}
+		}
+	})
+}
+
+func fetchExportRows(ctx context.Context, q querier, fn func(i *models.ItemResponse) error) (int, error) {
+	rows, err := q.QueryContext(ctx, `FETCH `+strconv.Itoa(exportFetchSize)+` FROM export_cursor`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	cnt := 0
+	for rows.Next() {
+		var i models.ItemResponse
+		err = rows.Scan(&i.ID, &i.Name, &i.Description, &i.EmployeeCount, &i.IsRegistered, &i.Type)
+		if err != nil {
+			return cnt, err
+		}
+		err = fn(&i)
+		if err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+	return cnt, rows.Err()
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// itemFilterWhere returns WHERE clause for companies table and its arguments
+func (c *db) itemFilterWhere(f *models.ItemFilter) (string, []interface{}) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if f.Name != "" {
+		args = append(args, "%"+escapeLike(f.Name)+"%")
+		if c.dialect == dialectSQLite {
+			// LIKE is case-insensitive in SQLite, but for ASCII letters only
+			where = append(where, "name LIKE $"+strconv.Itoa(len(args))+` ESCAPE '\'`)
+		} else {
+			where = append(where, "name ILIKE $"+strconv.Itoa(len(args)))
+		}
+	}
+	if f.Type != "" {
+		args = append(args, f.Type)
+		where = append(where, "legal_type = $"+strconv.Itoa(len(args)))
+	}
+	if f.IsRegistered != nil {
+		args = append(args, *f.IsRegistered)
+		where = append(where, "is_registered = $"+strconv.Itoa(len(args)))
+	}
+	if f.MinEmployees != nil {
+		args = append(args, *f.MinEmployees)
+		where = append(where, "employee_count >= $"+strconv.Itoa(len(args)))
+	}
+	if f.MaxEmployees != nil {
+		args = append(args, *f.MaxEmployees)
+		where = append(where, "employee_count <= $"+strconv.Itoa(len(args)))
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return ` WHERE ` + strings.Join(where, " AND "), args
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+func (c *db) CreateImportJob(ctx context.Context, format string, payload []byte) (*uuid.UUID, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO import_jobs (status, format, payload) VALUES ($1, $2, $3) RETURNING id`
+
+	var id uuid.UUID
+	err := c.q.QueryRowContext(ctx, query, models.JobStatusPending, format, payload).Scan(&id)
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	return &id, nil
+}
+
+// GetImportJob returns job state with row errors, but without payload
+func (c *db) GetImportJob(ctx context.Context, id uuid.UUID) (*models.ImportJob, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, status, format, total_rows, processed_rows, created_rows, failed_rows, error, created_at, updated_at
+	FROM import_jobs WHERE id = $1`
+
+	var j models.ImportJob
+	err := c.q.QueryRowContext(ctx, query, id.String()).Scan(&j.ID, &j.Status, &j.Format, &j.TotalRows, &j.ProcessedRows,
+		&j.CreatedRows, &j.FailedRows, &j.Error, &j.CreatedAt, &j.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+
+	rows, err := c.q.QueryContext(ctx, `SELECT row_num, error FROM import_job_errors WHERE job_id = $1 ORDER BY row_num`, id.String())
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	defer rows.Close()
+
+	j.Errors = []models.ImportRowError{}
+	for rows.Next() {
+		var e models.ImportRowError
+		err = rows.Scan(&e.Row, &e.Error)
+		if err != nil {
+			return nil, timeoutError(err)
+		}
+		j.Errors = append(j.Errors, e)
+	}
+	return &j, timeoutError(rows.Err())
+}
+
+// ClaimImportJob marks the oldest pending job as running and returns it with payload.
+// Running jobs which were not updated within lease are considered abandoned and could be claimed again.
+// Returns ErrNotFound if there is nothing to do.
+func (c *db) ClaimImportJob(ctx context.Context, lease time.Duration) (*models.ImportJob, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE import_jobs SET status = $1, epoch = epoch + 1, updated_at = now()
+	WHERE id = (
+		SELECT id FROM import_jobs
+		WHERE status = $2 OR (status = $1 AND updated_at < now() - $3 * interval '1 second')
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, status, format, payload, total_rows, processed_rows, created_rows, failed_rows, created_at, updated_at, epoch`
+
+	var j models.ImportJob
+	err := c.q.QueryRowContext(ctx, query, models.JobStatusRunning, models.JobStatusPending, lease.Seconds()).Scan(&j.ID, &j.Status,
+		&j.Format, &j.Payload, &j.TotalRows, &j.ProcessedRows, &j.CreatedRows, &j.FailedRows, &j.CreatedAt, &j.UpdatedAt, &j.Epoch)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	return &j, nil
+}
+
+// SaveImportProgress stores job counters and status together with new row errors.
+// Returns ErrLeaseLost if the job was claimed again since j was claimed, payload is dropped when the job is finished.
+func (c *db) SaveImportProgress(ctx context.Context, j *models.ImportJob, rowErrors []models.ImportRowError) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return timeoutError(err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `UPDATE import_jobs
+	SET status = $2, total_rows = $3, processed_rows = $4, created_rows = $5, failed_rows = $6, error = $7, updated_at = now()`
+	if j.Status == models.JobStatusDone || j.Status == models.JobStatusFailed {
+		query += `, payload = ''`
+	}
+	query += ` WHERE id = $1 AND epoch = $8`
+	res, err := tx.ExecContext(ctx, query, j.ID.String(), j.Status, j.TotalRows, j.ProcessedRows, j.CreatedRows, j.FailedRows, j.Error, j.Epoch)
+	if err != nil {
+		return timeoutError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return timeoutError(err)
+	}
+	if n == 0 {
+		return models.ErrLeaseLost
+	}
+
+	for _, e := range rowErrors {
+		_, err = tx.ExecContext(ctx, `INSERT INTO import_job_errors (job_id, row_num, error) VALUES ($1, $2, $3)
+		ON CONFLICT (job_id, row_num) DO UPDATE SET error = EXCLUDED.error`, j.ID.String(), e.Row, e.Error)
+		if err != nil {
+			return timeoutError(err)
+		}
+	}
+
+	return timeoutError(tx.Commit())
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// MergeItem moves the item from companies to company_merges, which keeps its last state and the id
+// it's redirected to. Redirects to the item are moved to its survivor, so there are no chains.
+// It's not retried on transient errors, like delete.
+func (c *db) MergeItem(ctx context.Context, id, into uuid.UUID) (*models.ItemResponse, error) {
+	if id == into {
+		return nil, models.ErrMergeItself
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var res models.ItemResponse
+	err := c.writeTx(ctx, func(tx *db) error {
+		var exists bool
+		err := tx.q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM companies WHERE id = $1)`, into.String()).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrNotFound
+		}
+
+		err = tx.q.QueryRowContext(ctx, `DELETE FROM companies WHERE id = $1
+	RETURNING id, name, description, employee_count, is_registered, legal_type`, id.String()).
+			Scan(&res.ID, &res.Name, &res.Description, &res.EmployeeCount, &res.IsRegistered, &res.Type)
+		if err == sql.ErrNoRows {
+			return models.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(&res)
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, `UPDATE company_merges SET target_id = $2 WHERE target_id = $1`, id.String(), into.String())
+		if err != nil {
+			return err
+		}
+		// the id could be merged before and then created again with PUT
+		_, err = tx.q.ExecContext(ctx, `DELETE FROM company_merges WHERE source_id = $1`, id.String())
+		if err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx, `INSERT INTO company_merges (source_id, target_id, data) VALUES ($1, $2, $3)`,
+			id.String(), into.String(), string(data))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *db) GetMergedInto(ctx context.Context, id uuid.UUID) (*uuid.UUID, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT target_id FROM company_merges WHERE source_id = $1`
+
+	var into uuid.UUID
+	err := c.read(ctx, func(q querier) error {
+		return q.QueryRowContext(ctx, query, id.String()).Scan(&into)
+	})
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &into, nil
+}
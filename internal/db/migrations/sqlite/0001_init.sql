@@ -0,0 +1,69 @@
+CREATE TABLE companies (
+  id text PRIMARY KEY NOT NULL,
+  name text NOT NULL UNIQUE,
+  description text NOT NULL,
+  employee_count integer NOT NULL,
+  is_registered boolean NOT NULL,
+  legal_type text NOT NULL
+);
+
+CREATE TABLE company_revisions (
+  company_id text NOT NULL,
+  revision integer NOT NULL,
+  event text NOT NULL,
+  data text NOT NULL,
+  created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+  seq integer NOT NULL UNIQUE,
+  PRIMARY KEY (company_id, revision)
+);
+
+-- SQLite has one writer at a time, so MAX(seq) + 1 gives gapless ordered sequence
+CREATE TRIGGER companies_revisions_insert
+AFTER INSERT ON companies
+BEGIN
+  INSERT INTO company_revisions (company_id, revision, event, data, seq)
+  SELECT NEW.id, COALESCE(MAX(revision), 0) + 1, 'created', json_object(
+    'id', NEW.id,
+    'name', NEW.name,
+    'description', NEW.description,
+    'employee_count', NEW.employee_count,
+    'is_registered', json(CASE WHEN NEW.is_registered THEN 'true' ELSE 'false' END),
+    'type', NEW.legal_type
+  ), (SELECT COALESCE(MAX(seq), 0) + 1 FROM company_revisions)
+  FROM company_revisions WHERE company_id = NEW.id;
+END;
+
+CREATE TRIGGER companies_revisions_update
+AFTER UPDATE ON companies
+WHEN OLD.name IS NOT NEW.name
+  OR OLD.description IS NOT NEW.description
+  OR OLD.employee_count IS NOT NEW.employee_count
+  OR OLD.is_registered IS NOT NEW.is_registered
+  OR OLD.legal_type IS NOT NEW.legal_type
+BEGIN
+  INSERT INTO company_revisions (company_id, revision, event, data, seq)
+  SELECT NEW.id, COALESCE(MAX(revision), 0) + 1, 'updated', json_object(
+    'id', NEW.id,
+    'name', NEW.name,
+    'description', NEW.description,
+    'employee_count', NEW.employee_count,
+    'is_registered', json(CASE WHEN NEW.is_registered THEN 'true' ELSE 'false' END),
+    'type', NEW.legal_type
+  ), (SELECT COALESCE(MAX(seq), 0) + 1 FROM company_revisions)
+  FROM company_revisions WHERE company_id = NEW.id;
+END;
+
+CREATE TRIGGER companies_revisions_delete
+AFTER DELETE ON companies
+BEGIN
+  INSERT INTO company_revisions (company_id, revision, event, data, seq)
+  SELECT OLD.id, COALESCE(MAX(revision), 0) + 1, 'deleted', json_object(
+    'id', OLD.id,
+    'name', OLD.name,
+    'description', OLD.description,
+    'employee_count', OLD.employee_count,
+    'is_registered', json(CASE WHEN OLD.is_registered THEN 'true' ELSE 'false' END),
+    'type', OLD.legal_type
+  ), (SELECT COALESCE(MAX(seq), 0) + 1 FROM company_revisions)
+  FROM company_revisions WHERE company_id = OLD.id;
+END;
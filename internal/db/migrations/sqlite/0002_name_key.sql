@@ -0,0 +1,3 @@
+-- name keys are computed by the service, existing companies get them on start
+ALTER TABLE companies ADD COLUMN name_key text;
+CREATE UNIQUE INDEX companies_name_key_uniq ON companies (name_key);
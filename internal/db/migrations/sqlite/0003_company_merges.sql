@@ -0,0 +1,8 @@
+-- merged companies are moved here, lookups of source_id are redirected to target_id
+CREATE TABLE company_merges (
+  source_id text PRIMARY KEY NOT NULL,
+  target_id text NOT NULL,
+  data text NOT NULL,
+  merged_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
+CREATE INDEX company_merges_target_id ON company_merges (target_id);
@@ -0,0 +1,2 @@
+-- similar names are looked up only among keys of close length
+CREATE INDEX companies_name_key_length ON companies (length(name_key));
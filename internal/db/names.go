@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// WithLegalSuffixStripping ignores legal forms like "Ltd" or "Inc." at the end of names in uniqueness check.
+// Name keys of existing companies are not recomputed when the setting changes, see README.
+func WithLegalSuffixStripping() Option {
+	return func(c *config) {
+		c.stripSuffixes = true
+	}
+}
+
+func (c *db) nameKey(name string) string {
+	return models.NameKey(name, c.stripSuffixes)
+}
+
+// duplicateNameError looks up the company which has the same name key, plain ErrDuplicateName is returned
+// if it's not visible, for example when it's created by the same transaction
+func (c *db) duplicateNameError(ctx context.Context, key string) error {
+	q := c.q
+	if c.dialect == dialectPostgres && c.inTransaction() {
+		// failed statement aborts Postgres transaction, so look outside of it
+		q = c.db
+	}
+	var id uuid.UUID
+	err := q.QueryRowContext(ctx, `SELECT id FROM companies WHERE name_key = $1`, key).Scan(&id)
+	if err != nil {
+		return models.ErrDuplicateName
+	}
+	return &models.DuplicateNameError{ID: id}
+}
+
+// fillNameKeys sets name keys of companies created before the name_key column was added or whose keys were reset
+// to be recomputed, it fails with the list of collisions which have to be resolved manually
+func (c *db) fillNameKeys(ctx context.Context) error {
+	rows, err := c.q.QueryContext(ctx, `SELECT id, name FROM companies WHERE name_key IS NULL ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	type company struct {
+		id   string
+		name string
+	}
+	var list []company
+	for rows.Next() {
+		var i company
+		err = rows.Scan(&i.id, &i.name)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, i)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	var collisions []string
+	for _, i := range list {
+		key := c.nameKey(i.name)
+		_, err = c.q.ExecContext(ctx, `UPDATE companies SET name_key = $1 WHERE id = $2`, key, i.id)
+		if err != nil && errIsDuplicate(err) {
+			var other string
+			_ = c.q.QueryRowContext(ctx, `SELECT id FROM companies WHERE name_key = $1`, key).Scan(&other)
+			collisions = append(collisions, fmt.Sprintf("%q (%s) and %s", i.name, i.id, other))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("companies with the same normalized name, rename them: %s", strings.Join(collisions, ", "))
+	}
+	return nil
+}
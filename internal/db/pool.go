@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type pool struct {
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+}
+
+// WithPool limits connection pool of primary and of every replica, zero values keep database/sql defaults
+func WithPool(maxOpen, maxIdle int, maxLifetime time.Duration) Option {
+	return func(c *config) {
+		c.pool = pool{maxOpen: maxOpen, maxIdle: maxIdle, maxLifetime: maxLifetime}
+	}
+}
+
+// WithStatementTimeout limits every storage operation with context deadline,
+// and sets statement_timeout for connections, so the server stops slow queries too
+func WithStatementTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+func openPostgres(dsn string, conf *config) (*sql.DB, error) {
+	pqConnector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	var connector driver.Connector = pqConnector
+	if conf.timeout > 0 {
+		connector = &timeoutConnector{Connector: pqConnector, timeout: conf.timeout}
+	}
+
+	dbConn := sql.OpenDB(connector)
+	if conf.pool.maxOpen > 0 {
+		dbConn.SetMaxOpenConns(conf.pool.maxOpen)
+	}
+	if conf.pool.maxIdle > 0 {
+		dbConn.SetMaxIdleConns(conf.pool.maxIdle)
+	}
+	if conf.pool.maxLifetime > 0 {
+		dbConn.SetConnMaxLifetime(conf.pool.maxLifetime)
+	}
+	return dbConn, nil
+}
+
+// timeoutConnector runs SET statement_timeout on every new connection
+type timeoutConnector struct {
+	driver.Connector
+	timeout time.Duration
+}
+
+func (c *timeoutConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := `SET statement_timeout = ` + strconv.FormatInt(c.timeout.Milliseconds(), 10)
+	_, err = conn.(driver.ExecerContext).ExecContext(ctx, query, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// withTimeout sets deadline of one storage operation, it also covers waiting for a free connection
+func (c *db) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
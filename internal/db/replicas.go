@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const defaultHealthCheckInterval = 5 * time.Second
+
+// WithReplicas sends reads to replicas in round-robin, writes and transactions always use primary
+func WithReplicas(dsns ...string) Option {
+	return func(c *config) {
+		c.replicas = dsns
+	}
+}
+
+// WithHealthCheck sets how often replicas are pinged, unhealthy replicas are skipped until they respond again
+func WithHealthCheck(interval time.Duration) Option {
+	return func(c *config) {
+		c.healthCheckInterval = interval
+	}
+}
+
+type replica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+type replicaSet struct {
+	list     []*replica
+	next     atomic.Uint64
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newReplicaSet checks replicas once and starts health checker, replica which is down at start doesn't fail startup
+func newReplicaSet(conns []*sql.DB, interval time.Duration) *replicaSet {
+	r := &replicaSet{interval: interval, stop: make(chan struct{})}
+	for _, dbConn := range conns {
+		r.list = append(r.list, &replica{db: dbConn})
+	}
+	r.check()
+
+	r.wg.Add(1)
+	go r.run()
+	return r
+}
+
+func (r *replicaSet) run() {
+	defer r.wg.Done()
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-t.C:
+			r.check()
+		}
+	}
+}
+
+func (r *replicaSet) check() {
+	for _, rep := range r.list {
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+		rep.healthy.Store(rep.db.PingContext(ctx) == nil)
+		cancel()
+	}
+}
+
+// pick returns the next healthy replica, or nil if all of them are down
+func (r *replicaSet) pick() *replica {
+	n := r.next.Add(1)
+	for k := range r.list {
+		rep := r.list[(n+uint64(k))%uint64(len(r.list))]
+		if rep.healthy.Load() {
+			return rep
+		}
+	}
+	return nil
+}
+
+func (r *replicaSet) close() {
+	close(r.stop)
+	r.wg.Wait()
+	for _, rep := range r.list {
+		rep.db.Close()
+	}
+}
+
+// replica returns replica for reads, or nil if reads must go to primary:
+// inside a transaction, for read-your-writes requests, or when no replica is healthy
+func (c *db) replica(ctx context.Context) *replica {
+	if c.replicas == nil || c.inTransaction() || models.ReadPrimary(ctx) {
+		return nil
+	}
+	return c.replicas.pick()
+}
+
+// read runs fn on a replica, if the replica fails it's marked down and fn is retried on primary.
+// Transient errors are retried too, reads are always idempotent.
+func (c *db) read(ctx context.Context, fn func(q querier) error) error {
+	return c.retry(ctx, func(int) error {
+		rep := c.replica(ctx)
+		if rep == nil {
+			return fn(c.q)
+		}
+		err := fn(rep.db)
+		if err == nil || errors.Is(err, sql.ErrNoRows) || ctx.Err() != nil {
+			return err
+		}
+		rep.healthy.Store(false)
+		return fn(c.db)
+	})
+}
+
+// beginRead starts read-only transaction on a replica, or on primary if there is no healthy replica or it fails
+func (c *db) beginRead(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	rep := c.replica(ctx)
+	if rep == nil {
+		return c.db.BeginTx(ctx, opts)
+	}
+	tx, err := rep.db.BeginTx(ctx, opts)
+	if err == nil || ctx.Err() != nil {
+		return tx, err
+	}
+	rep.healthy.Store(false)
+	return c.db.BeginTx(ctx, opts)
+}
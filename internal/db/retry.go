@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = 50 * time.Millisecond
+)
+
+// WithRetries sets how many times idempotent operations are attempted on transient errors,
+// backoff is doubled after every attempt
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.retryAttempts = attempts
+		c.retryBackoff = backoff
+	}
+}
+
+// commitError marks failed commit, transaction outcome is unknown so it must not be retried
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string { return e.err.Error() }
+func (e *commitError) Unwrap() error { return e.err }
+
+// errIsTransient reports errors after which the same operation could succeed:
+// serialization failures, deadlocks, failed connects, lost connections and server shutdown during failover
+func errIsTransient(err error) bool {
+	var ce *commitError
+	if errors.As(err, &ce) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", "40P01", "57P01":
+			return true
+		}
+		return pgErr.Code.Class() == "08"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return true
+		}
+	}
+	return false
+}
+
+// errIsUncommitted reports transient errors after which a single write statement is known to have no effect:
+// serialization failures and deadlocks roll it back, and connections which failed before the statement
+// was sent could not run it. Lost connections and server shutdown may come after commit.
+func errIsUncommitted(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", "40P01", "08001", "08004":
+			return true
+		}
+		return false
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return true
+		}
+	}
+	return false
+}
+
+// timeoutError wraps expired operation deadline and Postgres query_canceled error returned on statement_timeout
+// with ErrDBTimeout, other errors are returned as is
+func timeoutError(err error) error {
+	if err == nil || errors.Is(err, models.ErrDBTimeout) {
+		return err
+	}
+	var pgErr *pq.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &pgErr) && pgErr.Code == "57014") {
+		return fmt.Errorf("%w: %w", models.ErrDBTimeout, err)
+	}
+	return err
+}
+
+// retry runs idempotent fn again on transient errors, attempt starts from 1.
+// Inside a transaction fn is run once, since only the whole transaction could be retried.
+// When attempts are over transient error is returned wrapped with ErrDBUnavailable,
+// if the deadline expires while waiting for the next attempt it's wrapped with ErrDBTimeout.
+func (c *db) retry(ctx context.Context, fn func(attempt int) error) error {
+	return c.retryOn(ctx, errIsTransient, fn)
+}
+
+// retryOn is retry limited to errors accepted by retryable, other transient errors are reported
+// as ErrDBUnavailable right away
+func (c *db) retryOn(ctx context.Context, retryable func(error) bool, fn func(attempt int) error) error {
+	backoff := c.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || !errIsTransient(err) || c.inTransaction() {
+			return timeoutError(err)
+		}
+		if !retryable(err) {
+			return fmt.Errorf("%w: %w", models.ErrDBUnavailable, err)
+		}
+		if attempt >= c.retryAttempts {
+			return fmt.Errorf("%w: %w", models.ErrDBUnavailable, err)
+		}
+
+		// jitter spreads retries of concurrent requests
+		t := time.NewTimer(backoff + rand.N(backoff/2+1))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%w: %w", models.ErrDBTimeout, err)
+			}
+			return fmt.Errorf("%w: %w", models.ErrDBUnavailable, err)
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// SimilarItems finds companies by trigram similarity of name keys. "%" operator lets Postgres use the trigram index,
+// it matches only scores above pg_trgm.similarity_threshold, so the setting is changed to threshold in the read transaction.
+// SQLite has no trigrams, there name keys of close length are compared by Levenshtein distance.
+func (c *db) SimilarItems(ctx context.Context, name string, threshold float64, limit int) ([]models.SimilarItem, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	key := c.nameKey(name)
+	if c.dialect == dialectSQLite {
+		return c.sqliteSimilarItems(ctx, key, threshold, limit)
+	}
+
+	query := `SELECT id, name, similarity(name_key, $1) AS score FROM companies
+	WHERE name_key % $1 AND similarity(name_key, $1) >= $2
+	ORDER BY score DESC, id
+	LIMIT $3`
+
+	var list []models.SimilarItem
+	err := c.retry(ctx, func(int) error {
+		return c.readTx(ctx, &sql.TxOptions{ReadOnly: true}, func(q querier) error {
+			_, err := q.ExecContext(ctx, `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`,
+				strconv.FormatFloat(threshold, 'f', -1, 64))
+			if err != nil {
+				return err
+			}
+			rows, err := q.QueryContext(ctx, query, key, threshold, limit)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+
+			list = []models.SimilarItem{}
+			for rows.Next() {
+				var i models.SimilarItem
+				err = rows.Scan(&i.ID, &i.Name, &i.Score)
+				if err != nil {
+					return err
+				}
+				list = append(list, i)
+			}
+			return rows.Err()
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// sqliteSimilarItems reads only keys which are not too short or too long to reach threshold, length is indexed
+func (c *db) sqliteSimilarItems(ctx context.Context, key string, threshold float64, limit int) ([]models.SimilarItem, error) {
+	lo, hi := models.SimilarLengths(utf8.RuneCountInString(key), threshold)
+	var list []models.SimilarItem
+	err := c.read(ctx, func(q querier) error {
+		rows, err := q.QueryContext(ctx, `SELECT id, name, name_key FROM companies WHERE length(name_key) BETWEEN $1 AND $2`, lo, hi)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		list = []models.SimilarItem{}
+		for rows.Next() {
+			var (
+				i     models.SimilarItem
+				other string
+			)
+			err = rows.Scan(&i.ID, &i.Name, &other)
+			if err != nil {
+				return err
+			}
+			i.Score = models.NameSimilarity(key, other)
+			if i.Score >= threshold {
+				list = append(list, i)
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return models.SortSimilar(list, limit), nil
+}
@@ -0,0 +1,307 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// NewSQLite opens SQLite database and applies pending migrations, path is a file name or ":memory:".
+// Only companies storage is supported, audit log, import jobs and webhooks require PostgreSQL,
+// replica and pool options are ignored, since there is a single connection.
+func NewSQLite(path string, opts ...Option) (*db, error) {
+	dbConn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time, and every connection to ":memory:" is a separate database
+	dbConn.SetMaxOpenConns(1)
+
+	err = migrate(context.Background(), dbConn, sqliteMigrations, "migrations/sqlite")
+	if err != nil {
+		dbConn.Close()
+		return nil, err
+	}
+	conf := defaultConfig()
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	c := newDB(dbConn, nil, &conf)
+	c.dialect = dialectSQLite
+	err = c.fillNameKeys(context.Background())
+	if err != nil {
+		dbConn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// migrate applies migrations from dir which are not recorded in schema_migrations yet, in file name order
+func migrate(ctx context.Context, dbConn *sql.DB, fsys fs.FS, dir string) error {
+	_, err := dbConn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version text PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+	files, err := fs.Glob(fsys, dir+"/*.sql")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		version := strings.TrimSuffix(f[len(dir)+1:], ".sql")
+		var applied bool
+		err = dbConn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+		script, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return err
+		}
+		err = applyMigration(ctx, dbConn, version, string(script))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, dbConn *sql.DB, version, script string) error {
+	tx, err := dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertItem is used where Postgres detects upsert result itself
+func (c *db) insertItem(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest) error {
+	query := `INSERT INTO companies (id, name, description, employee_count, is_registered, legal_type, name_key)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	key := c.nameKey(i.Name)
+	_, err := c.q.ExecContext(ctx, query, id.String(), i.Name, i.Description, i.EmployeeCount, i.IsRegistered, i.Type, key)
+	if err != nil && errIsDuplicate(err) {
+		return c.duplicateNameError(ctx, key)
+	}
+	return err
+}
+
+func sqliteGetItemsQuery(ids []string) (string, []interface{}) {
+	if len(ids) == 0 {
+		return `SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE false`, nil
+	}
+	params := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for n := range ids {
+		params[n] = "$" + strconv.Itoa(n+1)
+		args[n] = ids[n]
+	}
+	return `SELECT id, name, description, employee_count, is_registered, legal_type FROM companies WHERE id IN (` +
+		strings.Join(params, ", ") + `)`, args
+}
+
+// sqliteExportItems reads filtered companies page by page with keyset pagination,
+// so the only connection is not held while fn runs
+func (c *db) sqliteExportItems(ctx context.Context, f *models.ItemFilter, fn func(i *models.ItemResponse) error) error {
+	where, args := c.itemFilterWhere(f)
+	if where == "" {
+		where = ` WHERE `
+	} else {
+		where += ` AND `
+	}
+	query := `SELECT id, name, description, employee_count, is_registered, legal_type FROM companies` + where +
+		`id > $` + strconv.Itoa(len(args)+1) + ` ORDER BY id LIMIT ` + strconv.Itoa(exportFetchSize)
+
+	last := ""
+	for {
+		page, err := c.sqliteExportPage(ctx, query, append(args, last))
+		if err != nil {
+			return timeoutError(err)
+		}
+		for n := range page {
+			err = fn(&page[n])
+			if err != nil {
+				return err
+			}
+		}
+		if len(page) < exportFetchSize {
+			return nil
+		}
+		last = page[len(page)-1].ID.String()
+	}
+}
+
+func (c *db) sqliteExportPage(ctx context.Context, query string, args []interface{}) ([]models.ItemResponse, error) {
+	rows, err := c.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := make([]models.ItemResponse, 0, exportFetchSize)
+	for rows.Next() {
+		var i models.ItemResponse
+		err = rows.Scan(&i.ID, &i.Name, &i.Description, &i.EmployeeCount, &i.IsRegistered, &i.Type)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, i)
+	}
+	return page, rows.Err()
+}
+
+// sqliteItemStats is ItemStats without percentile_cont and width_bucket:
+// percentiles are interpolated between two nearest rows, histogram bucket is found with CASE
+func sqliteItemStats(ctx context.Context, q querier, where string, args []interface{}, buckets []int) (*models.ItemStats, error) {
+	var res models.ItemStats
+	e := &res.EmployeeCount
+	query := `SELECT count(*), COALESCE(sum(is_registered), 0),
+		COALESCE(sum(employee_count), 0), COALESCE(avg(employee_count), 0),
+		COALESCE(min(employee_count), 0), COALESCE(max(employee_count), 0)
+	FROM companies` + where
+	err := q.QueryRowContext(ctx, query, args...).Scan(&res.Total, &res.ByRegistration.Registered,
+		&e.Sum, &e.Avg, &e.Min, &e.Max)
+	if err != nil {
+		return nil, err
+	}
+	res.ByRegistration.Unregistered = res.Total - res.ByRegistration.Registered
+
+	if res.Total > 0 {
+		for _, p := range []struct {
+			v   float64
+			res *float64
+		}{{0.5, &e.P50}, {0.9, &e.P90}, {0.99, &e.P99}} {
+			*p.res, err = sqlitePercentile(ctx, q, where, args, res.Total, p.v)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res.ByType = make(map[string]int, len(models.AcceptableLegalTypes))
+	for t := range models.AcceptableLegalTypes {
+		res.ByType[t] = 0
+	}
+	rows, err := q.QueryContext(ctx, `SELECT legal_type, count(*) FROM companies`+where+` GROUP BY legal_type`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			t   string
+			cnt int
+		)
+		err = rows.Scan(&t, &cnt)
+		if err != nil {
+			return nil, err
+		}
+		res.ByType[t] = cnt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// bucket n holds values which are not less than n bounds, the same as width_bucket does
+	bucket := "0"
+	hargs := args
+	res.Histogram = make([]models.HistogramBucket, len(buckets)+1)
+	if len(buckets) > 0 {
+		bucket = "CASE"
+		for n := range buckets {
+			hargs = append(hargs, buckets[n])
+			bucket += ` WHEN employee_count < $` + strconv.Itoa(len(hargs)) + ` THEN ` + strconv.Itoa(n)
+			res.Histogram[n].To = &buckets[n]
+			res.Histogram[n+1].From = &buckets[n]
+		}
+		bucket += ` ELSE ` + strconv.Itoa(len(buckets)) + ` END`
+	}
+	hrows, err := q.QueryContext(ctx, `SELECT `+bucket+` AS bucket, count(*) FROM companies`+where+` GROUP BY bucket`, hargs...)
+	if err != nil {
+		return nil, err
+	}
+	defer hrows.Close()
+	for hrows.Next() {
+		var n, cnt int
+		err = hrows.Scan(&n, &cnt)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 0 && n < len(res.Histogram) {
+			res.Histogram[n].Count = cnt
+		}
+	}
+	if err = hrows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// sqlitePercentile interpolates between closest ranks like percentile_cont does
+func sqlitePercentile(ctx context.Context, q querier, where string, args []interface{}, total int, p float64) (float64, error) {
+	pos := p * float64(total-1)
+	lo := int(pos)
+	query := `SELECT employee_count FROM companies` + where + ` ORDER BY employee_count LIMIT 2 OFFSET ` + strconv.Itoa(lo)
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var values []float64
+	for rows.Next() {
+		var v float64
+		err = rows.Scan(&v)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, v)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	switch len(values) {
+	case 0:
+		return 0, nil
+	case 1:
+		return values[0], nil
+	}
+	return values[0] + (pos-float64(lo))*(values[1]-values[0]), nil
+}
+
+func sqliteErrIsDuplicate(err error) bool {
+	var e *sqlite.Error
+	if errors.As(err, &e) {
+		// the message names violated columns, like "companies.name_key"
+		return e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(e.Error(), "companies.name")
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/lib/pq"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// ItemStats aggregates filtered companies, all queries run in one snapshot so numbers are consistent.
+// buckets are ascending histogram bounds, result has len(buckets)+1 buckets.
+func (c *db) ItemStats(ctx context.Context, f *models.ItemFilter, buckets []int) (*models.ItemStats, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	var res *models.ItemStats
+	err := c.retry(ctx, func(int) (err error) {
+		res, err = c.itemStats(ctx, f, buckets)
+		return err
+	})
+	return res, err
+}
+
+func (c *db) itemStats(ctx context.Context, f *models.ItemFilter, buckets []int) (*models.ItemStats, error) {
+	where, args := c.itemFilterWhere(f)
+	opts := &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead}
+	stats := pgItemStats
+	if c.dialect == dialectSQLite {
+		opts, stats = &sql.TxOptions{ReadOnly: true}, sqliteItemStats
+	}
+
+	var res *models.ItemStats
+	err := c.readTx(ctx, opts, func(q querier) (err error) {
+		res, err = stats(ctx, q, where, args, buckets)
+		return err
+	})
+	return res, err
+}
+
+func pgItemStats(ctx context.Context, q querier, where string, args []interface{}, buckets []int) (*models.ItemStats, error) {
+	var res models.ItemStats
+	e := &res.EmployeeCount
+	query := `SELECT count(*), count(*) FILTER (WHERE is_registered),
+		COALESCE(sum(employee_count), 0), COALESCE(avg(employee_count), 0),
+		COALESCE(min(employee_count), 0), COALESCE(max(employee_count), 0),
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY employee_count), 0),
+		COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY employee_count), 0),
+		COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY employee_count), 0)
+	FROM companies` + where
+	err := q.QueryRowContext(ctx, query, args...).Scan(&res.Total, &res.ByRegistration.Registered,
+		&e.Sum, &e.Avg, &e.Min, &e.Max, &e.P50, &e.P90, &e.P99)
+	if err != nil {
+		return nil, err
+	}
+	res.ByRegistration.Unregistered = res.Total - res.ByRegistration.Registered
+
+	res.ByType = make(map[string]int, len(models.AcceptableLegalTypes))
+	for t := range models.AcceptableLegalTypes {
+		res.ByType[t] = 0
+	}
+	rows, err := q.QueryContext(ctx, `SELECT legal_type, count(*) FROM companies`+where+` GROUP BY legal_type`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			t   string
+			cnt int
+		)
+		err = rows.Scan(&t, &cnt)
+		if err != nil {
+			return nil, err
+		}
+		res.ByType[t] = cnt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	bounds := make([]int64, len(buckets))
+	res.Histogram = make([]models.HistogramBucket, len(buckets)+1)
+	for n := range buckets {
+		bounds[n] = int64(buckets[n])
+		res.Histogram[n].To = &buckets[n]
+		res.Histogram[n+1].From = &buckets[n]
+	}
+	// width_bucket returns 0 for values below the first bound and len(buckets) for values above the last one
+	query = `SELECT width_bucket(employee_count, $` + strconv.Itoa(len(args)+1) + `::int[]) AS bucket, count(*)
+	FROM companies` + where + ` GROUP BY bucket`
+	hrows, err := q.QueryContext(ctx, query, append(args, pq.Array(bounds))...)
+	if err != nil {
+		return nil, err
+	}
+	defer hrows.Close()
+	for hrows.Next() {
+		var n, cnt int
+		err = hrows.Scan(&n, &cnt)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 0 && n < len(res.Histogram) {
+			res.Histogram[n].Count = cnt
+		}
+	}
+	if err = hrows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
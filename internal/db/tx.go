@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// WithTx runs fn with storage which executes all calls in one transaction, it's committed if fn returns nil.
+// Nested calls join the outer transaction. fn is not retried on transient errors, since it could have
+// side effects besides storage calls.
+func (c *db) WithTx(ctx context.Context, fn func(tx models.StorageInt) error) error {
+	return c.writeTx(ctx, func(tx *db) error {
+		return fn(tx)
+	})
+}
+
+// writeTx runs fn in a new transaction, or in the current one if c is already in a transaction
+func (c *db) writeTx(ctx context.Context, fn func(tx *db) error) error {
+	if c.inTransaction() {
+		return fn(c)
+	}
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return timeoutError(err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	err = fn(c.inTx(tx))
+	if err != nil {
+		return timeoutError(err)
+	}
+	return timeoutError(tx.Commit())
+}
+
+// inTransaction is true for copies made by inTx
+func (c *db) inTransaction() bool {
+	return c.q != querier(c.db)
+}
+
+// readTx runs fn in a new read-only transaction, or in the current one if c is already in a transaction.
+// The transaction is started on a replica if there is one, replica which fails to start it is marked down
+// and the transaction is started on primary like in read.
+func (c *db) readTx(ctx context.Context, opts *sql.TxOptions, fn func(q querier) error) error {
+	if c.inTransaction() {
+		return fn(c.q)
+	}
+	tx, err := c.beginRead(ctx, opts)
+	if err != nil {
+		return timeoutError(err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	return timeoutError(fn(tx))
+}
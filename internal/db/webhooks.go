@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const webhookColumns = `id, url, events, secret, enabled, failures, created_at, updated_at`
+
+func (c *db) CreateWebhook(ctx context.Context, r *models.WebhookRequest) (*models.Webhook, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO webhooks (url, events, secret, enabled) VALUES ($1, $2, $3, $4)
+	RETURNING ` + webhookColumns
+
+	w, err := scanWebhook(c.q.QueryRowContext(ctx, query, r.URL, pq.Array(webhookEvents(r)), r.Secret, webhookEnabled(r)))
+	return w, timeoutError(err)
+}
+
+// ReplaceWebhook overwrites subscription, consecutive failures counter is reset
+func (c *db) ReplaceWebhook(ctx context.Context, id uuid.UUID, r *models.WebhookRequest) (*models.Webhook, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE webhooks SET url = $2, events = $3, secret = $4, enabled = $5, failures = 0, updated_at = now()
+	WHERE id = $1
+	RETURNING ` + webhookColumns
+
+	w, err := scanWebhook(c.q.QueryRowContext(ctx, query, id.String(), r.URL, pq.Array(webhookEvents(r)), r.Secret, webhookEnabled(r)))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	return w, timeoutError(err)
+}
+
+func (c *db) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	res, err := c.q.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id.String())
+	if err != nil {
+		return timeoutError(err)
+	}
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return timeoutError(err)
+	}
+	if cnt == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+func (c *db) GetWebhook(ctx context.Context, id uuid.UUID) (*models.Webhook, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	w, err := scanWebhook(c.q.QueryRowContext(ctx, query, id.String()))
+	if err == sql.ErrNoRows {
+		return nil, models.ErrNotFound
+	}
+	return w, timeoutError(err)
+}
+
+func (c *db) ListWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY created_at`
+
+	rows, err := c.q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	defer rows.Close()
+
+	list := []models.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, timeoutError(err)
+		}
+		list = append(list, *w)
+	}
+	return list, timeoutError(rows.Err())
+}
+
+func (c *db) AddWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO webhook_deliveries (webhook_id, company_id, event, attempt, status, error, duration_ms)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := c.q.ExecContext(ctx, query, d.WebhookID.String(), d.CompanyID.String(), d.Event, d.Attempt, d.Status, d.Error, d.DurationMs)
+	return timeoutError(err)
+}
+
+// ListWebhookDeliveries returns the latest delivery attempts first
+func (c *db) ListWebhookDeliveries(ctx context.Context, id uuid.UUID, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, webhook_id, company_id, event, attempt, status, error, duration_ms, created_at
+	FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2`
+
+	rows, err := c.q.QueryContext(ctx, query, id.String(), limit)
+	if err != nil {
+		return nil, timeoutError(err)
+	}
+	defer rows.Close()
+
+	list := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.CompanyID, &d.Event, &d.Attempt, &d.Status, &d.Error, &d.DurationMs, &d.CreatedAt)
+		if err != nil {
+			return nil, timeoutError(err)
+		}
+		list = append(list, d)
+	}
+	return list, timeoutError(rows.Err())
+}
+
+func (c *db) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	res, err := c.q.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, timeoutError(err)
+	}
+	return res.RowsAffected()
+}
+
+func (c *db) RecordWebhookResult(ctx context.Context, id uuid.UUID, success bool, maxFailures int) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE webhooks SET failures = 0 WHERE id = $1 AND failures > 0`
+	args := []interface{}{id.String()}
+	if !success {
+		query = `UPDATE webhooks SET failures = failures + 1, enabled = enabled AND failures + 1 < $2 WHERE id = $1`
+		args = append(args, maxFailures)
+	}
+	_, err := c.q.ExecContext(ctx, query, args...)
+	return timeoutError(err)
+}
+
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	var w models.Webhook
+	err := row.Scan(&w.ID, &w.URL, pq.Array(&w.Events), &w.Secret, &w.Enabled, &w.Failures, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+	return &w, nil
+}
+
+func webhookEvents(r *models.WebhookRequest) []string {
+	if r.Events == nil {
+		return []string{}
+	}
+	return r.Events
+}
+
+func webhookEnabled(r *models.WebhookRequest) bool {
+	return r.Enabled == nil || *r.Enabled
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// subscriber buffer, subscriber which falls behind more than this is disconnected
+const subscriberBuffer = 256
+
+// broker keeps bounded log of recent events and publishes them to local subscribers.
+// It wraps another notifier, so every notification sent by the service also goes to subscribers.
+type broker struct {
+	next models.NotifyInt
+	// event IDs are "epoch-seq", epoch changes on restart so stale IDs are detected
+	epoch string
+
+	mu   sync.Mutex
+	seq  uint64
+	ring []models.Event
+	cnt  int
+	subs map[chan models.Event]struct{}
+}
+
+func New(next models.NotifyInt, size int) *broker {
+	return &broker{
+		next:  next,
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		ring:  make([]models.Event, size),
+		subs:  map[chan models.Event]struct{}{},
+	}
+}
+
+// Send publishes event to subscribers and passes it to the wrapped notifier
+func (b *broker) Send(event models.EventNotifications) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+
+	b.mu.Lock()
+	b.seq++
+	e := models.Event{ID: b.epoch + "-" + strconv.FormatUint(b.seq, 10), Data: event}
+	if len(b.ring) > 0 {
+		b.ring[(b.seq-1)%uint64(len(b.ring))] = e
+		if b.cnt < len(b.ring) {
+			b.cnt++
+		}
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// slow subscriber, it should reconnect and resume from the log
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	b.mu.Unlock()
+
+	if b.next == nil {
+		return nil
+	}
+	return b.next.Send(event)
+}
+
+// Subscribe returns events after lastID and a channel for live ones, empty lastID means live events only
+func (b *broker) Subscribe(lastID string) *models.EventSubscription {
+	ch := make(chan models.Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := models.EventSubscription{C: ch}
+	if lastID != "" {
+		oldest := b.seq - uint64(b.cnt) + 1
+		from := oldest
+		seq, ok := b.parseID(lastID)
+		if ok && seq+1 >= oldest && seq <= b.seq {
+			from = seq + 1
+		} else {
+			sub.Reset = true
+		}
+		for s := from; s <= b.seq; s++ {
+			sub.Backlog = append(sub.Backlog, b.ring[(s-1)%uint64(len(b.ring))])
+		}
+	}
+
+	b.subs[ch] = struct{}{}
+	sub.Cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return &sub
+}
+
+func (b *broker) parseID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func (b *broker) Close() {
+	b.mu.Lock()
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+
+	if b.next != nil {
+		b.next.Close()
+	}
+}
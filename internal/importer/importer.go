@@ -0,0 +1,208 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	// progress is saved every saveEvery rows, it also refreshes the job lease
+	saveEvery = 100
+	// running job which was not saved for this long is considered abandoned and is picked up again
+	jobLease = time.Minute
+	// idle workers check the queue this often, so jobs submitted to other instances are processed too
+	pollInterval = 10 * time.Second
+)
+
+type importer struct {
+	log    *zerolog.Logger
+	stor   models.StorageInt
+	jobs   models.JobStorageInt
+	notify models.NotifyInt
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(log *zerolog.Logger, stor models.StorageInt, jobs models.JobStorageInt, notify models.NotifyInt) *importer {
+	return &importer{
+		log:    log,
+		stor:   stor,
+		jobs:   jobs,
+		notify: notify,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Start runs background worker, unfinished jobs left from previous runs are resumed
+func (i *importer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		i.run(ctx)
+	}()
+}
+
+// Close stops the worker, progress of current job is saved and it's left in running state to be resumed after restart
+func (i *importer) Close() {
+	if i.cancel != nil {
+		i.cancel()
+	}
+	i.wg.Wait()
+}
+
+// Submit stores the payload as a new pending job
+func (i *importer) Submit(ctx context.Context, format string, payload []byte) (*uuid.UUID, error) {
+	id, err := i.jobs.CreateImportJob(ctx, format, payload)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case i.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+func (i *importer) GetJob(ctx context.Context, id uuid.UUID) (*models.ImportJob, error) {
+	return i.jobs.GetImportJob(ctx, id)
+}
+
+func (i *importer) run(ctx context.Context) {
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		// drain the queue
+		for ctx.Err() == nil {
+			job, err := i.jobs.ClaimImportJob(ctx, jobLease)
+			if err == models.ErrNotFound {
+				break
+			}
+			if err != nil {
+				i.log.Err(err).Msg("import job claim failed")
+				break
+			}
+			i.process(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-i.wake:
+		case <-t.C:
+		}
+	}
+}
+
+// process creates items row by row, rows processed before restart are skipped.
+// Item ids are derived from job id and row number, so rows replayed after a crash or lease takeover
+// are found already created instead of failing on duplicate names.
+func (i *importer) process(ctx context.Context, job *models.ImportJob) {
+	log := i.log.With().Str("JobID", job.ID.String()).Logger()
+	log.Info().Int("ProcessedRows", job.ProcessedRows).Msg("import job started")
+
+	rows, err := parseRows(job.Format, job.Payload)
+	if err != nil {
+		log.Err(err).Msg("import payload parse failed")
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+		i.save(ctx, &log, job, nil)
+		return
+	}
+	job.TotalRows = len(rows)
+
+	var rowErrors []models.ImportRowError
+	for _, r := range rows[job.ProcessedRows:] {
+		if ctx.Err() != nil {
+			break
+		}
+
+		err = i.createRow(ctx, job.ID, &r)
+		if err != nil && ctx.Err() != nil {
+			// the row is interrupted by Close, it will be processed again on resume
+			break
+		}
+		if err != nil {
+			log.Err(err).Int("Row", r.num).Msg("import row failed")
+			job.FailedRows++
+			rowErrors = append(rowErrors, models.ImportRowError{Row: r.num, Error: err.Error()})
+		} else {
+			job.CreatedRows++
+		}
+		job.ProcessedRows++
+
+		if job.ProcessedRows%saveEvery == 0 && job.ProcessedRows < job.TotalRows {
+			if !i.save(ctx, &log, job, rowErrors) {
+				return
+			}
+			rowErrors = nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		// keep progress made since the last save, the job stays running and is resumed after restart
+		if i.save(context.WithoutCancel(ctx), &log, job, rowErrors) {
+			log.Info().Int("ProcessedRows", job.ProcessedRows).Msg("import job is interrupted")
+		}
+		return
+	}
+
+	job.Status = models.JobStatusDone
+	if i.save(ctx, &log, job, rowErrors) {
+		log.Info().Int("Created", job.CreatedRows).Int("Failed", job.FailedRows).Msg("import job is done")
+	}
+}
+
+func (i *importer) createRow(ctx context.Context, jobID uuid.UUID, r *row) error {
+	if r.err != nil {
+		return r.err
+	}
+	err := r.req.Validate()
+	if err != nil {
+		return err
+	}
+	id := uuid.NewSHA1(jobID, []byte(strconv.Itoa(r.num)))
+	created, err := i.stor.CreateItemWithID(ctx, id, &r.req)
+	if err != nil {
+		if !errors.Is(err, models.ErrDuplicateName) {
+			err = models.ErrDBError
+		}
+		return err
+	}
+	if !created {
+		// created by previous run of the job, which has already sent the notification
+		return nil
+	}
+
+	err = i.notify.Send(models.EventNotifications{ID: id, Event: models.EventTypeCreated})
+	if err != nil {
+		i.log.Err(err).Msg("notification send failed")
+	}
+	return nil
+}
+
+// save stores job progress, on failure the job is abandoned and will be resumed after lease expiration,
+// if the lease is already lost, the job is continued by another worker
+func (i *importer) save(ctx context.Context, log *zerolog.Logger, job *models.ImportJob, rowErrors []models.ImportRowError) bool {
+	err := i.jobs.SaveImportProgress(ctx, job, rowErrors)
+	if err == models.ErrLeaseLost {
+		log.Warn().Msg("import job is taken over by another worker")
+		return false
+	}
+	if err != nil {
+		log.Err(err).Msg("import progress save failed")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+var (
+	errUnknownFormat = errors.New("Unknown import format")
+	errInvalidHeader = errors.New("Invalid CSV header")
+	errInvalidCSV    = errors.New("Invalid CSV")
+)
+
+// columns which must be present in CSV header, "description" and "id" are optional, the latter is ignored
+var requiredColumns = []string{"name", "employee_count", "is_registered", "type"}
+
+// row is a single parsed input record, err is set if it could not be decoded
+type row struct {
+	num int
+	req models.ItemCreateRequest
+	err error
+}
+
+// parseRows decodes whole payload, row numbers are 1-based line numbers of data records
+func parseRows(format string, payload []byte) ([]row, error) {
+	switch format {
+	case models.ImportFormatCSV:
+		return parseCSV(payload)
+	case models.ImportFormatNDJSON:
+		return parseNDJSON(payload)
+	}
+	return nil, errUnknownFormat
+}
+
+// parseCSV expects a header row, so files produced by export could be imported back
+func parseCSV(payload []byte) ([]row, error) {
+	r := csv.NewReader(bytes.NewReader(payload))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, errInvalidHeader
+	}
+	cols := map[string]int{}
+	for n, h := range header {
+		cols[h] = n
+	}
+	for _, c := range requiredColumns {
+		if _, ok := cols[c]; !ok {
+			return nil, errInvalidHeader
+		}
+	}
+
+	var rows []row
+	for num := 1; ; num++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errInvalidCSV
+		}
+		if len(rec) != len(header) {
+			rows = append(rows, row{num: num, err: models.ErrInvalidRequest})
+			continue
+		}
+		rows = append(rows, csvRow(num, rec, cols))
+	}
+	return rows, nil
+}
+
+func csvRow(num int, rec []string, cols map[string]int) row {
+	res := row{num: num}
+	res.req.Name = rec[cols["name"]]
+	res.req.Type = rec[cols["type"]]
+	if n, ok := cols["description"]; ok {
+		res.req.Description = rec[n]
+	}
+	var err error
+	res.req.EmployeeCount, err = strconv.Atoi(rec[cols["employee_count"]])
+	if err != nil {
+		res.err = models.ErrInvalidRequest
+		return res
+	}
+	res.req.IsRegistered, err = strconv.ParseBool(rec[cols["is_registered"]])
+	if err != nil {
+		res.err = models.ErrInvalidRequest
+	}
+	return res
+}
+
+// parseNDJSON decodes one object per line, blank lines are skipped but still counted,
+// unknown fields are ignored like in create request, so export output could be imported back
+func parseNDJSON(payload []byte) ([]row, error) {
+	s := bufio.NewScanner(bytes.NewReader(payload))
+	s.Buffer(nil, 1<<20)
+
+	var rows []row
+	for num := 1; s.Scan(); num++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		res := row{num: num}
+		if err := json.Unmarshal(line, &res.req); err != nil {
+			res.err = models.ErrInvalidRequest
+		}
+		rows = append(rows, res)
+	}
+	if s.Err() != nil {
+		return nil, s.Err()
+	}
+	return rows, nil
+}
@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/IBM/sarama"
+	"github.com/rs/zerolog"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+type listener struct {
+	log        *zerolog.Logger
+	c          sarama.Consumer
+	partitions []sarama.PartitionConsumer
+	wg         sync.WaitGroup
+}
+
+// NewListener reads notifications from all partitions of the topic starting from the newest ones
+// and passes them to fn. There's no consumer group, so every instance receives every event.
+func NewListener(log *zerolog.Logger, host, topic string, fn func(event models.EventNotifications)) (*listener, error) {
+	hosts := strings.Split(host, ",")
+	c, err := sarama.NewConsumer(hosts, sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	l := &listener{log: log, c: c}
+
+	ids, err := c.Partitions(topic)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	for _, id := range ids {
+		pc, err := c.ConsumePartition(topic, id, sarama.OffsetNewest)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.partitions = append(l.partitions, pc)
+		l.wg.Add(1)
+		go l.run(pc, fn)
+	}
+	return l, nil
+}
+
+func (l *listener) run(pc sarama.PartitionConsumer, fn func(event models.EventNotifications)) {
+	defer l.wg.Done()
+	for msg := range pc.Messages() {
+		var event models.EventNotifications
+		err := json.Unmarshal(msg.Value, &event)
+		if err != nil {
+			l.log.Err(err).Str("Message", string(msg.Value)).Msg("failed to unmarshal kafka event")
+			continue
+		}
+		fn(event)
+	}
+}
+
+func (l *listener) Close() {
+	for _, pc := range l.partitions {
+		pc.AsyncClose()
+	}
+	l.wg.Wait()
+	l.c.Close()
+}
@@ -0,0 +1,601 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// memory is StorageInt kept in process memory, it follows semantics of Postgres storage:
+// names are unique, no-op updates are not recorded as revisions, export is ordered by id
+type memory struct {
+	mu sync.RWMutex
+	s  state
+}
+
+type state struct {
+	items map[uuid.UUID]models.ItemResponse
+	// companies by name key
+	names         map[string]uuid.UUID
+	stripSuffixes bool
+	// changes feed, Seq is index+1
+	changes []models.Change
+	// indexes of changes per company
+	revisions map[uuid.UUID][]int
+	// merged companies redirected to survivors
+	merged map[uuid.UUID]uuid.UUID
+	// entries changed by current atomic batch or transaction, nil outside of them
+	undo *undoLog
+}
+
+// undoLog keeps previous values of entries touched since begin, so rollback restores only them
+type undoLog struct {
+	items     map[uuid.UUID]saved[models.ItemResponse]
+	names     map[string]saved[uuid.UUID]
+	revisions map[uuid.UUID]saved[[]int]
+	merged    map[uuid.UUID]saved[uuid.UUID]
+	// length of changes feed, which is append-only
+	changes int
+}
+
+// saved is a map entry before the change, ok is false if there was no entry
+type saved[V any] struct {
+	v  V
+	ok bool
+}
+
+type Option func(m *memory)
+
+// WithLegalSuffixStripping ignores legal forms like "Ltd" or "Inc." at the end of names in uniqueness check
+func WithLegalSuffixStripping() Option {
+	return func(m *memory) {
+		m.s.stripSuffixes = true
+	}
+}
+
+func New(opts ...Option) *memory {
+	m := &memory{s: state{
+		items:     map[uuid.UUID]models.ItemResponse{},
+		names:     map[string]uuid.UUID{},
+		revisions: map[uuid.UUID][]int{},
+		merged:    map[uuid.UUID]uuid.UUID{},
+	}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *memory) CreateItem(ctx context.Context, i *models.ItemCreateRequest) (*uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, err := m.s.create(uuid.New(), i)
+	if err != nil {
+		return nil, err
+	}
+	return &item.ID, nil
+}
+
+func (m *memory) CreateItemWithID(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.s.items[id]; ok {
+		return false, nil
+	}
+	_, err := m.s.create(id, i)
+	return err == nil, err
+}
+
+func (m *memory) UpdateItem(ctx context.Context, id uuid.UUID, i *models.ItemUpdateRequest) (*models.ItemResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.s.update(id, i)
+}
+
+func (m *memory) ReplaceItem(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest, upsert bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.s.items[id]; !ok {
+		if !upsert {
+			return false, models.ErrNotFound
+		}
+		_, err := m.s.create(id, i)
+		return err == nil, err
+	}
+	_, err := m.s.update(id, &models.ItemUpdateRequest{
+		Name:          &i.Name,
+		Description:   &i.Description,
+		EmployeeCount: &i.EmployeeCount,
+		IsRegistered:  &i.IsRegistered,
+		Type:          &i.Type,
+	})
+	return false, err
+}
+
+func (m *memory) DeleteItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.s.delete(id)
+}
+
+func (m *memory) MergeItem(ctx context.Context, id, into uuid.UUID) (*models.ItemResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.s.merge(id, into)
+}
+
+func (m *memory) GetMergedInto(ctx context.Context, id uuid.UUID) (*uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	into, ok := m.s.merged[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &into, nil
+}
+
+func (m *memory) GetItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i, ok := m.s.items[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	return &i, nil
+}
+
+// LockItem is GetItem, WithTx holds the storage lock until fn returns
+func (m *memory) LockItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	return m.GetItem(ctx, id)
+}
+
+// GetItems returns all found items in unspecified order
+func (m *memory) GetItems(ctx context.Context, ids []uuid.UUID) ([]models.ItemResponse, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var res []models.ItemResponse
+	for _, id := range ids {
+		if i, ok := m.s.items[id]; ok {
+			res = append(res, i)
+		}
+	}
+	return res, nil
+}
+
+// ExportItems passes filtered items ordered by id to fn, the lock is not held while fn runs
+func (m *memory) ExportItems(ctx context.Context, f *models.ItemFilter, fn func(i *models.ItemResponse) error) error {
+	list := m.filter(f)
+	sort.Slice(list, func(a, b int) bool {
+		return bytes.Compare(list[a].ID[:], list[b].ID[:]) < 0
+	})
+	for n := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn(&list[n])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ItemStats aggregates filtered items, percentiles are interpolated like percentile_cont does
+func (m *memory) ItemStats(ctx context.Context, f *models.ItemFilter, buckets []int) (*models.ItemStats, error) {
+	list := m.filter(f)
+
+	res := models.ItemStats{
+		Total:     len(list),
+		ByType:    make(map[string]int, len(models.AcceptableLegalTypes)),
+		Histogram: make([]models.HistogramBucket, len(buckets)+1),
+	}
+	for t := range models.AcceptableLegalTypes {
+		res.ByType[t] = 0
+	}
+	for n := range buckets {
+		res.Histogram[n].To = &buckets[n]
+		res.Histogram[n+1].From = &buckets[n]
+	}
+
+	counts := make([]int, 0, len(list))
+	for _, i := range list {
+		res.ByType[i.Type]++
+		if i.IsRegistered {
+			res.ByRegistration.Registered++
+		} else {
+			res.ByRegistration.Unregistered++
+		}
+		res.EmployeeCount.Sum += int64(i.EmployeeCount)
+		counts = append(counts, i.EmployeeCount)
+
+		// the same as width_bucket: number of bounds which are less or equal to the value
+		res.Histogram[sort.Search(len(buckets), func(n int) bool { return buckets[n] > i.EmployeeCount })].Count++
+	}
+	if len(counts) == 0 {
+		return &res, nil
+	}
+
+	sort.Ints(counts)
+	e := &res.EmployeeCount
+	e.Avg = float64(e.Sum) / float64(len(counts))
+	e.Min = counts[0]
+	e.Max = counts[len(counts)-1]
+	e.P50 = percentile(counts, 0.5)
+	e.P90 = percentile(counts, 0.9)
+	e.P99 = percentile(counts, 0.99)
+	return &res, nil
+}
+
+// ApplyBatch executes batch items one by one. In atomic mode the state is restored on the first failure,
+// and the rest of items are reported as aborted.
+func (m *memory) ApplyBatch(ctx context.Context, items []models.BatchItem, atomic bool) ([]models.BatchItemResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var prev *undoLog
+	if atomic {
+		prev = m.s.begin()
+	}
+	res := make([]models.BatchItemResult, len(items))
+	for n := range items {
+		res[n] = m.s.applyBatchItem(&items[n])
+		if res[n].Err != nil && atomic {
+			m.s.rollback(prev)
+			for k := range res {
+				if k != n {
+					res[k] = models.BatchItemResult{Err: models.ErrBatchAborted}
+				}
+			}
+			return res, nil
+		}
+	}
+	if atomic {
+		m.s.commit(prev)
+	}
+	return res, nil
+}
+
+// WithTx runs fn on the state with undo log, changes made by fn are rolled back if it fails.
+// Other calls wait until fn returns, fn must use only the storage it was given.
+func (m *memory) WithTx(ctx context.Context, fn func(tx models.StorageInt) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &memory{s: m.s}
+	prev := tx.s.begin()
+	err := fn(tx)
+	if err != nil {
+		tx.s.rollback(prev)
+	} else {
+		tx.s.commit(prev)
+	}
+	m.s = tx.s
+	return err
+}
+
+// SimilarItems compares name keys of companies by Levenshtein distance, keys which are too short
+// or too long to reach the threshold are skipped
+func (m *memory) SimilarItems(ctx context.Context, name string, threshold float64, limit int) ([]models.SimilarItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	key := models.NameKey(name, m.s.stripSuffixes)
+	lo, hi := models.SimilarLengths(utf8.RuneCountInString(key), threshold)
+	var list []models.SimilarItem
+	for k, id := range m.s.names {
+		if n := utf8.RuneCountInString(k); n < lo || n > hi {
+			continue
+		}
+		score := models.NameSimilarity(key, k)
+		if score >= threshold {
+			list = append(list, models.SimilarItem{ID: id, Name: m.s.items[id].Name, Score: score})
+		}
+	}
+	return models.SortSimilar(list, limit), nil
+}
+
+func (m *memory) ListRevisions(ctx context.Context, id uuid.UUID) ([]models.ItemRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	idx := m.s.revisions[id]
+	if len(idx) == 0 {
+		return nil, models.ErrNotFound
+	}
+	list := make([]models.ItemRevision, len(idx))
+	for n, k := range idx {
+		list[n] = revision(&m.s.changes[k])
+	}
+	return list, nil
+}
+
+func (m *memory) GetRevision(ctx context.Context, id uuid.UUID, rev int) (*models.ItemRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.s.revisions[id] {
+		if m.s.changes[k].Revision == rev {
+			r := revision(&m.s.changes[k])
+			return &r, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// ListChanges returns changes of all items with sequence number greater than since
+func (m *memory) ListChanges(ctx context.Context, since int64, limit int) ([]models.Change, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := []models.Change{}
+	if since < int64(len(m.s.changes)) {
+		end := min(int(since)+limit, len(m.s.changes))
+		list = append(list, m.s.changes[since:end]...)
+	}
+	return list, nil
+}
+
+func (m *memory) Close() {}
+
+func (m *memory) filter(f *models.ItemFilter) []models.ItemResponse {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	name := strings.ToLower(f.Name)
+	var list []models.ItemResponse
+	for _, i := range m.s.items {
+		if name != "" && !strings.Contains(strings.ToLower(i.Name), name) {
+			continue
+		}
+		if f.Type != "" && i.Type != f.Type {
+			continue
+		}
+		if f.IsRegistered != nil && i.IsRegistered != *f.IsRegistered {
+			continue
+		}
+		if f.MinEmployees != nil && i.EmployeeCount < *f.MinEmployees {
+			continue
+		}
+		if f.MaxEmployees != nil && i.EmployeeCount > *f.MaxEmployees {
+			continue
+		}
+		list = append(list, i)
+	}
+	return list
+}
+
+func (s *state) create(id uuid.UUID, i *models.ItemCreateRequest) (*models.ItemResponse, error) {
+	key := models.NameKey(i.Name, s.stripSuffixes)
+	if other, ok := s.names[key]; ok {
+		return nil, &models.DuplicateNameError{ID: other}
+	}
+	item := models.ItemResponse{
+		ID:            id,
+		Name:          i.Name,
+		Description:   i.Description,
+		EmployeeCount: i.EmployeeCount,
+		IsRegistered:  i.IsRegistered,
+		Type:          i.Type,
+	}
+	s.setItem(id, item)
+	s.setName(key, id)
+	s.record(&item, models.EventTypeCreated)
+	return &item, nil
+}
+
+func (s *state) update(id uuid.UUID, i *models.ItemUpdateRequest) (*models.ItemResponse, error) {
+	old, ok := s.items[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	item := old
+	if i.Name != nil {
+		item.Name = *i.Name
+	}
+	if i.Description != nil {
+		item.Description = *i.Description
+	}
+	if i.EmployeeCount != nil {
+		item.EmployeeCount = *i.EmployeeCount
+	}
+	if i.IsRegistered != nil {
+		item.IsRegistered = *i.IsRegistered
+	}
+	if i.Type != nil {
+		item.Type = *i.Type
+	}
+	key := models.NameKey(item.Name, s.stripSuffixes)
+	if other, ok := s.names[key]; ok && other != id {
+		return nil, &models.DuplicateNameError{ID: other}
+	}
+	if item == old {
+		return &item, nil
+	}
+
+	s.deleteName(models.NameKey(old.Name, s.stripSuffixes))
+	s.setName(key, id)
+	s.setItem(id, item)
+	s.record(&item, models.EventTypeUpdated)
+	return &item, nil
+}
+
+func (s *state) delete(id uuid.UUID) (*models.ItemResponse, error) {
+	item, ok := s.items[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	s.deleteItem(id)
+	s.deleteName(models.NameKey(item.Name, s.stripSuffixes))
+	s.record(&item, models.EventTypeDeleted)
+	return &item, nil
+}
+
+// merge deletes the item and redirects it and items merged into it before to the survivor
+func (s *state) merge(id, into uuid.UUID) (*models.ItemResponse, error) {
+	if id == into {
+		return nil, models.ErrMergeItself
+	}
+	if _, ok := s.items[into]; !ok {
+		return nil, models.ErrNotFound
+	}
+	item, err := s.delete(id)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.merged {
+		if v == id {
+			s.setMerged(k, into)
+		}
+	}
+	s.setMerged(id, into)
+	return item, nil
+}
+
+// record adds revision of item to changes feed, like the revisions trigger does
+func (s *state) record(item *models.ItemResponse, event string) {
+	rev := 1
+	if idx := s.revisions[item.ID]; len(idx) > 0 {
+		rev = s.changes[idx[len(idx)-1]].Revision + 1
+	}
+	s.changes = append(s.changes, models.Change{
+		Seq:       int64(len(s.changes) + 1),
+		ID:        item.ID,
+		Revision:  rev,
+		Event:     event,
+		Item:      *item,
+		CreatedAt: time.Now().UTC(),
+	})
+	if s.undo != nil {
+		save(s.undo.revisions, s.revisions, item.ID)
+	}
+	s.revisions[item.ID] = append(s.revisions[item.ID], len(s.changes)-1)
+}
+
+func (s *state) applyBatchItem(item *models.BatchItem) models.BatchItemResult {
+	switch item.Op {
+	case models.BatchOpCreate:
+		i, err := s.create(uuid.New(), item.Create)
+		return models.BatchItemResult{Item: i, Err: err}
+	case models.BatchOpUpdate:
+		i, err := s.update(item.ID, item.Update)
+		return models.BatchItemResult{Item: i, Err: err}
+	case models.BatchOpDelete:
+		i, err := s.delete(item.ID)
+		return models.BatchItemResult{Item: i, Err: err}
+	}
+	return models.BatchItemResult{Err: models.ErrInvalidOperation}
+}
+
+func (s *state) setItem(id uuid.UUID, item models.ItemResponse) {
+	if s.undo != nil {
+		save(s.undo.items, s.items, id)
+	}
+	s.items[id] = item
+}
+
+func (s *state) deleteItem(id uuid.UUID) {
+	if s.undo != nil {
+		save(s.undo.items, s.items, id)
+	}
+	delete(s.items, id)
+}
+
+func (s *state) setName(key string, id uuid.UUID) {
+	if s.undo != nil {
+		save(s.undo.names, s.names, key)
+	}
+	s.names[key] = id
+}
+
+func (s *state) deleteName(key string) {
+	if s.undo != nil {
+		save(s.undo.names, s.names, key)
+	}
+	delete(s.names, key)
+}
+
+func (s *state) setMerged(id, into uuid.UUID) {
+	if s.undo != nil {
+		save(s.undo.merged, s.merged, id)
+	}
+	s.merged[id] = into
+}
+
+// begin starts undo log and returns the log of enclosing batch or transaction
+func (s *state) begin() *undoLog {
+	prev := s.undo
+	s.undo = &undoLog{
+		items:     map[uuid.UUID]saved[models.ItemResponse]{},
+		names:     map[string]saved[uuid.UUID]{},
+		revisions: map[uuid.UUID]saved[[]int]{},
+		merged:    map[uuid.UUID]saved[uuid.UUID]{},
+		changes:   len(s.changes),
+	}
+	return prev
+}
+
+// commit keeps the changes, enclosing log takes entries it has not saved yet
+func (s *state) commit(prev *undoLog) {
+	if prev != nil {
+		keepFirst(prev.items, s.undo.items)
+		keepFirst(prev.names, s.undo.names)
+		keepFirst(prev.revisions, s.undo.revisions)
+		keepFirst(prev.merged, s.undo.merged)
+	}
+	s.undo = prev
+}
+
+// rollback restores entries touched since begin
+func (s *state) rollback(prev *undoLog) {
+	restore(s.items, s.undo.items)
+	restore(s.names, s.undo.names)
+	restore(s.revisions, s.undo.revisions)
+	restore(s.merged, s.undo.merged)
+	s.changes = s.changes[:s.undo.changes]
+	s.undo = prev
+}
+
+// save remembers entry k of m unless it is already saved
+func save[K comparable, V any](log map[K]saved[V], m map[K]V, k K) {
+	if _, ok := log[k]; ok {
+		return
+	}
+	v, ok := m[k]
+	log[k] = saved[V]{v: v, ok: ok}
+}
+
+func restore[K comparable, V any](m map[K]V, log map[K]saved[V]) {
+	for k, e := range log {
+		if e.ok {
+			m[k] = e.v
+		} else {
+			delete(m, k)
+		}
+	}
+}
+
+func keepFirst[K comparable, V any](log, next map[K]saved[V]) {
+	for k, e := range next {
+		if _, ok := log[k]; !ok {
+			log[k] = e
+		}
+	}
+}
+
+func revision(c *models.Change) models.ItemRevision {
+	return models.ItemRevision{Revision: c.Revision, Event: c.Event, Item: c.Item, CreatedAt: c.CreatedAt}
+}
+
+// percentile interpolates between closest ranks of sorted values
+func percentile(sorted []int, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lo := int(pos)
+	if lo+1 >= len(sorted) {
+		return float64(sorted[lo])
+	}
+	return float64(sorted[lo]) + (pos-float64(lo))*float64(sorted[lo+1]-sorted[lo])
+}
@@ -0,0 +1,103 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mannulus-immortalis/xmtask/internal/memory"
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+func TestRollback(t *testing.T) {
+	t.Run("error_atomic_batch", func(t *testing.T) {
+		ctx := context.Background()
+		stor := memory.New()
+		id, err := stor.CreateItem(ctx, &models.ItemCreateRequest{Name: "first", EmployeeCount: 1, Type: "Corporations"})
+		assert.NoError(t, err)
+		_, err = stor.CreateItem(ctx, &models.ItemCreateRequest{Name: "second", EmployeeCount: 2, Type: "Corporations"})
+		assert.NoError(t, err)
+
+		// the last item fails, so rename of the first company is restored
+		name := "renamed"
+		res, err := stor.ApplyBatch(ctx, []models.BatchItem{
+			{Op: models.BatchOpUpdate, ID: *id, Update: &models.ItemUpdateRequest{Name: &name}},
+			{Op: models.BatchOpCreate, Create: &models.ItemCreateRequest{Name: "third", EmployeeCount: 3, Type: "Corporations"}},
+			{Op: models.BatchOpCreate, Create: &models.ItemCreateRequest{Name: "second", EmployeeCount: 4, Type: "Corporations"}},
+		}, true)
+		assert.NoError(t, err)
+
+		// test result
+		assert.Equal(t, models.ErrBatchAborted, res[0].Err)
+		item, err := stor.GetItem(ctx, *id)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", item.Name)
+		revisions, err := stor.ListRevisions(ctx, *id)
+		assert.NoError(t, err)
+		assert.Len(t, revisions, 1)
+		changes, err := stor.ListChanges(ctx, 0, 10)
+		assert.NoError(t, err)
+		assert.Len(t, changes, 2)
+		_, err = stor.CreateItem(ctx, &models.ItemCreateRequest{Name: "renamed", EmployeeCount: 5, Type: "Corporations"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("success_batch_in_tx", func(t *testing.T) {
+		ctx := context.Background()
+		stor := memory.New()
+		var id *uuid.UUID
+
+		// failed batch is rolled back, changes made by the transaction before it are kept
+		err := stor.WithTx(ctx, func(tx models.StorageInt) error {
+			var err error
+			id, err = tx.CreateItem(ctx, &models.ItemCreateRequest{Name: "first", EmployeeCount: 1, Type: "Corporations"})
+			if err != nil {
+				return err
+			}
+			count := 2
+			_, err = tx.ApplyBatch(ctx, []models.BatchItem{
+				{Op: models.BatchOpUpdate, ID: *id, Update: &models.ItemUpdateRequest{EmployeeCount: &count}},
+				{Op: models.BatchOpCreate, Create: &models.ItemCreateRequest{Name: "first", EmployeeCount: 3, Type: "Corporations"}},
+			}, true)
+			return err
+		})
+
+		// test result
+		assert.NoError(t, err)
+		item, err := stor.GetItem(ctx, *id)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, item.EmployeeCount)
+		changes, err := stor.ListChanges(ctx, 0, 10)
+		assert.NoError(t, err)
+		assert.Len(t, changes, 1)
+	})
+
+	t.Run("error_tx_merge", func(t *testing.T) {
+		ctx := context.Background()
+		stor := memory.New()
+		id, err := stor.CreateItem(ctx, &models.ItemCreateRequest{Name: "first", EmployeeCount: 1, Type: "Corporations"})
+		assert.NoError(t, err)
+		into, err := stor.CreateItem(ctx, &models.ItemCreateRequest{Name: "second", EmployeeCount: 2, Type: "Corporations"})
+		assert.NoError(t, err)
+
+		// merge is undone when the transaction fails
+		errFailed := errors.New("failed")
+		err = stor.WithTx(ctx, func(tx models.StorageInt) error {
+			_, err := tx.MergeItem(ctx, *id, *into)
+			if err != nil {
+				return err
+			}
+			return errFailed
+		})
+
+		// test result
+		assert.Equal(t, errFailed, err)
+		_, err = stor.GetItem(ctx, *id)
+		assert.NoError(t, err)
+		_, err = stor.GetMergedInto(ctx, *id)
+		assert.Equal(t, models.ErrNotFound, err)
+	})
+}
@@ -0,0 +1,13 @@
+package models
+
+import "context"
+
+// ReadPrimaryKey marks request context which reads must not go to replicas,
+// it's a string so it could be set in gin.Context keys
+const ReadPrimaryKey = "read_primary"
+
+// ReadPrimary reports whether reads of the request must go to the primary DB
+func ReadPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(ReadPrimaryKey).(bool)
+	return v
+}
@@ -2,24 +2,88 @@ package models
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type StorageInt interface {
 	CreateItem(ctx context.Context, i *ItemCreateRequest) (*uuid.UUID, error)
-	UpdateItem(ctx context.Context, id uuid.UUID, i *ItemUpdateRequest) error
-	DeleteItem(ctx context.Context, id uuid.UUID) error
+	// CreateItemWithID returns false if the item with the id already exists, it's left unchanged then
+	CreateItemWithID(ctx context.Context, id uuid.UUID, i *ItemCreateRequest) (bool, error)
+	UpdateItem(ctx context.Context, id uuid.UUID, i *ItemUpdateRequest) (*ItemResponse, error)
+	ReplaceItem(ctx context.Context, id uuid.UUID, i *ItemCreateRequest, upsert bool) (bool, error)
+	DeleteItem(ctx context.Context, id uuid.UUID) (*ItemResponse, error)
 	GetItem(ctx context.Context, id uuid.UUID) (*ItemResponse, error)
+	GetItems(ctx context.Context, ids []uuid.UUID) ([]ItemResponse, error)
+	ExportItems(ctx context.Context, f *ItemFilter, fn func(i *ItemResponse) error) error
+	ItemStats(ctx context.Context, f *ItemFilter, buckets []int) (*ItemStats, error)
+	ApplyBatch(ctx context.Context, items []BatchItem, atomic bool) ([]BatchItemResult, error)
+	ListRevisions(ctx context.Context, id uuid.UUID) ([]ItemRevision, error)
+	GetRevision(ctx context.Context, id uuid.UUID, revision int) (*ItemRevision, error)
+	ListChanges(ctx context.Context, since int64, limit int) ([]Change, error)
+	// LockItem reads the item which stays locked until the end of the transaction started by WithTx
+	LockItem(ctx context.Context, id uuid.UUID) (*ItemResponse, error)
+	// MergeItem soft-deletes the item, later lookups of its id are redirected to the item it was merged into
+	MergeItem(ctx context.Context, id, into uuid.UUID) (*ItemResponse, error)
+	// GetMergedInto returns id of the item which the merged item was redirected to, ErrNotFound if it wasn't merged
+	GetMergedInto(ctx context.Context, id uuid.UUID) (*uuid.UUID, error)
+	// SimilarItems returns companies which names have similarity score not less than threshold, best first
+	SimilarItems(ctx context.Context, name string, threshold float64, limit int) ([]SimilarItem, error)
+	// WithTx runs fn with storage which makes all calls in one transaction,
+	// it's committed if fn returns nil and rolled back otherwise
+	WithTx(ctx context.Context, fn func(tx StorageInt) error) error
 	Close()
 }
 
 type AuthInt interface {
 	TokenHasRole(tokenString, role string) (bool, error)
+	ParseToken(tokenString string) (*Identity, error)
 	Generate(roles []string) (string, error)
+	GenerateWithSubject(subject string, roles []string) (string, error)
 }
 
 type NotifyInt interface {
 	Send(event EventNotifications) error
 	Close()
 }
+
+type EventStreamInt interface {
+	Subscribe(lastID string) *EventSubscription
+}
+
+type AuditInt interface {
+	AddAuditRecords(ctx context.Context, list []AuditRecord) error
+	ListAuditRecords(ctx context.Context, f *AuditFilter) ([]AuditRecord, error)
+}
+
+type JobStorageInt interface {
+	CreateImportJob(ctx context.Context, format string, payload []byte) (*uuid.UUID, error)
+	GetImportJob(ctx context.Context, id uuid.UUID) (*ImportJob, error)
+	ClaimImportJob(ctx context.Context, lease time.Duration) (*ImportJob, error)
+	SaveImportProgress(ctx context.Context, job *ImportJob, rowErrors []ImportRowError) error
+}
+
+type ImporterInt interface {
+	Submit(ctx context.Context, format string, payload []byte) (*uuid.UUID, error)
+	GetJob(ctx context.Context, id uuid.UUID) (*ImportJob, error)
+}
+
+type WebhookStorageInt interface {
+	CreateWebhook(ctx context.Context, r *WebhookRequest) (*Webhook, error)
+	ReplaceWebhook(ctx context.Context, id uuid.UUID, r *WebhookRequest) (*Webhook, error)
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	GetWebhook(ctx context.Context, id uuid.UUID) (*Webhook, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	AddWebhookDelivery(ctx context.Context, d *WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, id uuid.UUID, limit int) ([]WebhookDelivery, error)
+	// DeleteWebhookDeliveries removes delivery log recorded before the time, returns number of removed records
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+	// RecordWebhookResult resets consecutive failures counter on success, otherwise increments it
+	// and disables the webhook when maxFailures is reached
+	RecordWebhookResult(ctx context.Context, id uuid.UUID, success bool, maxFailures int) error
+}
+
+type CacheStatsInt interface {
+	Stats() CacheStats
+}
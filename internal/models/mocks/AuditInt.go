@@ -0,0 +1,77 @@
+// Code generated by mockery v2.38.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/mannulus-immortalis/xmtask/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// AuditInt is an autogenerated mock type for the AuditInt type
+type AuditInt struct {
+	mock.Mock
+}
+
+// AddAuditRecords provides a mock function with given fields: ctx, list
+func (_m *AuditInt) AddAuditRecords(ctx context.Context, list []models.AuditRecord) error {
+	ret := _m.Called(ctx, list)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddAuditRecords")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []models.AuditRecord) error); ok {
+		r0 = rf(ctx, list)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListAuditRecords provides a mock function with given fields: ctx, f
+func (_m *AuditInt) ListAuditRecords(ctx context.Context, f *models.AuditFilter) ([]models.AuditRecord, error) {
+	ret := _m.Called(ctx, f)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListAuditRecords")
+	}
+
+	var r0 []models.AuditRecord
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.AuditFilter) ([]models.AuditRecord, error)); ok {
+		return rf(ctx, f)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *models.AuditFilter) []models.AuditRecord); ok {
+		r0 = rf(ctx, f)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.AuditRecord)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *models.AuditFilter) error); ok {
+		r1 = rf(ctx, f)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewAuditInt creates a new instance of AuditInt. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewAuditInt(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *AuditInt {
+	mock := &AuditInt{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
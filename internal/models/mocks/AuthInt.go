@@ -2,7 +2,10 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	models "github.com/mannulus-immortalis/xmtask/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // AuthInt is an autogenerated mock type for the AuthInt type
 type AuthInt struct {
@@ -37,6 +40,64 @@ func (_m *AuthInt) Generate(roles []string) (string, error) {
 	return r0, r1
 }
 
+// GenerateWithSubject provides a mock function with given fields: subject, roles
+func (_m *AuthInt) GenerateWithSubject(subject string, roles []string) (string, error) {
+	ret := _m.Called(subject, roles)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GenerateWithSubject")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, []string) (string, error)); ok {
+		return rf(subject, roles)
+	}
+	if rf, ok := ret.Get(0).(func(string, []string) string); ok {
+		r0 = rf(subject, roles)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, []string) error); ok {
+		r1 = rf(subject, roles)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ParseToken provides a mock function with given fields: tokenString
+func (_m *AuthInt) ParseToken(tokenString string) (*models.Identity, error) {
+	ret := _m.Called(tokenString)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ParseToken")
+	}
+
+	var r0 *models.Identity
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) (*models.Identity, error)); ok {
+		return rf(tokenString)
+	}
+	if rf, ok := ret.Get(0).(func(string) *models.Identity); ok {
+		r0 = rf(tokenString)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.Identity)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(tokenString)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // TokenHasRole provides a mock function with given fields: tokenString, role
 func (_m *AuthInt) TokenHasRole(tokenString string, role string) (bool, error) {
 	ret := _m.Called(tokenString, role)
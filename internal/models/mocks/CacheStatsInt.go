@@ -0,0 +1,45 @@
+// Code generated by mockery v2.38.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	models "github.com/mannulus-immortalis/xmtask/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// CacheStatsInt is an autogenerated mock type for the CacheStatsInt type
+type CacheStatsInt struct {
+	mock.Mock
+}
+
+// Stats provides a mock function with given fields:
+func (_m *CacheStatsInt) Stats() models.CacheStats {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Stats")
+	}
+
+	var r0 models.CacheStats
+	if rf, ok := ret.Get(0).(func() models.CacheStats); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(models.CacheStats)
+	}
+
+	return r0
+}
+
+// NewCacheStatsInt creates a new instance of CacheStatsInt. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewCacheStatsInt(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *CacheStatsInt {
+	mock := &CacheStatsInt{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,47 @@
+// Code generated by mockery v2.38.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	models "github.com/mannulus-immortalis/xmtask/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// EventStreamInt is an autogenerated mock type for the EventStreamInt type
+type EventStreamInt struct {
+	mock.Mock
+}
+
+// Subscribe provides a mock function with given fields: lastID
+func (_m *EventStreamInt) Subscribe(lastID string) *models.EventSubscription {
+	ret := _m.Called(lastID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Subscribe")
+	}
+
+	var r0 *models.EventSubscription
+	if rf, ok := ret.Get(0).(func(string) *models.EventSubscription); ok {
+		r0 = rf(lastID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.EventSubscription)
+		}
+	}
+
+	return r0
+}
+
+// NewEventStreamInt creates a new instance of EventStreamInt. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewEventStreamInt(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *EventStreamInt {
+	mock := &EventStreamInt{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
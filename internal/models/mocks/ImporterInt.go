@@ -0,0 +1,91 @@
+// Code generated by mockery v2.38.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/mannulus-immortalis/xmtask/internal/models"
+	mock "github.com/stretchr/testify/mock"
+
+	uuid "github.com/google/uuid"
+)
+
+// ImporterInt is an autogenerated mock type for the ImporterInt type
+type ImporterInt struct {
+	mock.Mock
+}
+
+// GetJob provides a mock function with given fields: ctx, id
+func (_m *ImporterInt) GetJob(ctx context.Context, id uuid.UUID) (*models.ImportJob, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetJob")
+	}
+
+	var r0 *models.ImportJob
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) (*models.ImportJob, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *models.ImportJob); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ImportJob)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Submit provides a mock function with given fields: ctx, format, payload
+func (_m *ImporterInt) Submit(ctx context.Context, format string, payload []byte) (*uuid.UUID, error) {
+	ret := _m.Called(ctx, format, payload)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Submit")
+	}
+
+	var r0 *uuid.UUID
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) (*uuid.UUID, error)); ok {
+		return rf(ctx, format, payload)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) *uuid.UUID); ok {
+		r0 = rf(ctx, format, payload)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*uuid.UUID)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, []byte) error); ok {
+		r1 = rf(ctx, format, payload)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewImporterInt creates a new instance of ImporterInt. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewImporterInt(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *ImporterInt {
+	mock := &ImporterInt{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
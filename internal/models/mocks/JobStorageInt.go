@@ -0,0 +1,141 @@
+// Code generated by mockery v2.38.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	models "github.com/mannulus-immortalis/xmtask/internal/models"
+	mock "github.com/stretchr/testify/mock"
+
+	time "time"
+
+	uuid "github.com/google/uuid"
+)
+
+// JobStorageInt is an autogenerated mock type for the JobStorageInt type
+type JobStorageInt struct {
+	mock.Mock
+}
+
+// ClaimImportJob provides a mock function with given fields: ctx, lease
+func (_m *JobStorageInt) ClaimImportJob(ctx context.Context, lease time.Duration) (*models.ImportJob, error) {
+	ret := _m.Called(ctx, lease)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ClaimImportJob")
+	}
+
+	var r0 *models.ImportJob
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration) (*models.ImportJob, error)); ok {
+		return rf(ctx, lease)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration) *models.ImportJob); ok {
+		r0 = rf(ctx, lease)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ImportJob)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration) error); ok {
+		r1 = rf(ctx, lease)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateImportJob provides a mock function with given fields: ctx, format, payload
+func (_m *JobStorageInt) CreateImportJob(ctx context.Context, format string, payload []byte) (*uuid.UUID, error) {
+	ret := _m.Called(ctx, format, payload)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateImportJob")
+	}
+
+	var r0 *uuid.UUID
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) (*uuid.UUID, error)); ok {
+		return rf(ctx, format, payload)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, []byte) *uuid.UUID); ok {
+		r0 = rf(ctx, format, payload)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*uuid.UUID)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, []byte) error); ok {
+		r1 = rf(ctx, format, payload)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetImportJob provides a mock function with given fields: ctx, id
+func (_m *JobStorageInt) GetImportJob(ctx context.Context, id uuid.UUID) (*models.ImportJob, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetImportJob")
+	}
+
+	var r0 *models.ImportJob
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) (*models.ImportJob, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *models.ImportJob); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ImportJob)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveImportProgress provides a mock function with given fields: ctx, job, rowErrors
+func (_m *JobStorageInt) SaveImportProgress(ctx context.Context, job *models.ImportJob, rowErrors []models.ImportRowError) error {
+	ret := _m.Called(ctx, job, rowErrors)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveImportProgress")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.ImportJob, []models.ImportRowError) error); ok {
+		r0 = rf(ctx, job, rowErrors)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NewJobStorageInt creates a new instance of JobStorageInt. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewJobStorageInt(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *JobStorageInt {
+	mock := &JobStorageInt{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -16,6 +16,36 @@ type StorageInt struct {
 	mock.Mock
 }
 
+// ApplyBatch provides a mock function with given fields: ctx, items, atomic
+func (_m *StorageInt) ApplyBatch(ctx context.Context, items []models.BatchItem, atomic bool) ([]models.BatchItemResult, error) {
+	ret := _m.Called(ctx, items, atomic)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ApplyBatch")
+	}
+
+	var r0 []models.BatchItemResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []models.BatchItem, bool) ([]models.BatchItemResult, error)); ok {
+		return rf(ctx, items, atomic)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []models.BatchItem, bool) []models.BatchItemResult); ok {
+		r0 = rf(ctx, items, atomic)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.BatchItemResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []models.BatchItem, bool) error); ok {
+		r1 = rf(ctx, items, atomic)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields:
 func (_m *StorageInt) Close() {
 	_m.Called()
@@ -51,17 +81,75 @@ func (_m *StorageInt) CreateItem(ctx context.Context, i *models.ItemCreateReques
 	return r0, r1
 }
 
+// CreateItemWithID provides a mock function with given fields: ctx, id, i
+func (_m *StorageInt) CreateItemWithID(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest) (bool, error) {
+	ret := _m.Called(ctx, id, i)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateItemWithID")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, *models.ItemCreateRequest) (bool, error)); ok {
+		return rf(ctx, id, i)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, *models.ItemCreateRequest) bool); ok {
+		r0 = rf(ctx, id, i)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, *models.ItemCreateRequest) error); ok {
+		r1 = rf(ctx, id, i)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteItem provides a mock function with given fields: ctx, id
-func (_m *StorageInt) DeleteItem(ctx context.Context, id uuid.UUID) error {
+func (_m *StorageInt) DeleteItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
 	ret := _m.Called(ctx, id)
 
 	if len(ret) == 0 {
 		panic("no return value specified for DeleteItem")
 	}
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) error); ok {
+	var r0 *models.ItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) (*models.ItemResponse, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *models.ItemResponse); ok {
 		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ExportItems provides a mock function with given fields: ctx, f, fn
+func (_m *StorageInt) ExportItems(ctx context.Context, f *models.ItemFilter, fn func(*models.ItemResponse) error) error {
+	ret := _m.Called(ctx, f, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ExportItems")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.ItemFilter, func(*models.ItemResponse) error) error); ok {
+		r0 = rf(ctx, f, fn)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -99,17 +187,345 @@ func (_m *StorageInt) GetItem(ctx context.Context, id uuid.UUID) (*models.ItemRe
 	return r0, r1
 }
 
+// GetItems provides a mock function with given fields: ctx, ids
+func (_m *StorageInt) GetItems(ctx context.Context, ids []uuid.UUID) ([]models.ItemResponse, error) {
+	ret := _m.Called(ctx, ids)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetItems")
+	}
+
+	var r0 []models.ItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, []uuid.UUID) ([]models.ItemResponse, error)); ok {
+		return rf(ctx, ids)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, []uuid.UUID) []models.ItemResponse); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.ItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, []uuid.UUID) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMergedInto provides a mock function with given fields: ctx, id
+func (_m *StorageInt) GetMergedInto(ctx context.Context, id uuid.UUID) (*uuid.UUID, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetMergedInto")
+	}
+
+	var r0 *uuid.UUID
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) (*uuid.UUID, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *uuid.UUID); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*uuid.UUID)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRevision provides a mock function with given fields: ctx, id, revision
+func (_m *StorageInt) GetRevision(ctx context.Context, id uuid.UUID, revision int) (*models.ItemRevision, error) {
+	ret := _m.Called(ctx, id, revision)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRevision")
+	}
+
+	var r0 *models.ItemRevision
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, int) (*models.ItemRevision, error)); ok {
+		return rf(ctx, id, revision)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, int) *models.ItemRevision); ok {
+		r0 = rf(ctx, id, revision)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ItemRevision)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, int) error); ok {
+		r1 = rf(ctx, id, revision)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ItemStats provides a mock function with given fields: ctx, f, buckets
+func (_m *StorageInt) ItemStats(ctx context.Context, f *models.ItemFilter, buckets []int) (*models.ItemStats, error) {
+	ret := _m.Called(ctx, f, buckets)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ItemStats")
+	}
+
+	var r0 *models.ItemStats
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *models.ItemFilter, []int) (*models.ItemStats, error)); ok {
+		return rf(ctx, f, buckets)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *models.ItemFilter, []int) *models.ItemStats); ok {
+		r0 = rf(ctx, f, buckets)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ItemStats)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *models.ItemFilter, []int) error); ok {
+		r1 = rf(ctx, f, buckets)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListChanges provides a mock function with given fields: ctx, since, limit
+func (_m *StorageInt) ListChanges(ctx context.Context, since int64, limit int) ([]models.Change, error) {
+	ret := _m.Called(ctx, since, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListChanges")
+	}
+
+	var r0 []models.Change
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) ([]models.Change, error)); ok {
+		return rf(ctx, since, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int) []models.Change); ok {
+		r0 = rf(ctx, since, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.Change)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int) error); ok {
+		r1 = rf(ctx, since, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListRevisions provides a mock function with given fields: ctx, id
+func (_m *StorageInt) ListRevisions(ctx context.Context, id uuid.UUID) ([]models.ItemRevision, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListRevisions")
+	}
+
+	var r0 []models.ItemRevision
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) ([]models.ItemRevision, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) []models.ItemRevision); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.ItemRevision)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LockItem provides a mock function with given fields: ctx, id
+func (_m *StorageInt) LockItem(ctx context.Context, id uuid.UUID) (*models.ItemResponse, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LockItem")
+	}
+
+	var r0 *models.ItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) (*models.ItemResponse, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *models.ItemResponse); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MergeItem provides a mock function with given fields: ctx, id, into
+func (_m *StorageInt) MergeItem(ctx context.Context, id uuid.UUID, into uuid.UUID) (*models.ItemResponse, error) {
+	ret := _m.Called(ctx, id, into)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MergeItem")
+	}
+
+	var r0 *models.ItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, uuid.UUID) (*models.ItemResponse, error)); ok {
+		return rf(ctx, id, into)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, uuid.UUID) *models.ItemResponse); ok {
+		r0 = rf(ctx, id, into)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, uuid.UUID) error); ok {
+		r1 = rf(ctx, id, into)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplaceItem provides a mock function with given fields: ctx, id, i, upsert
+func (_m *StorageInt) ReplaceItem(ctx context.Context, id uuid.UUID, i *models.ItemCreateRequest, upsert bool) (bool, error) {
+	ret := _m.Called(ctx, id, i, upsert)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReplaceItem")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, *models.ItemCreateRequest, bool) (bool, error)); ok {
+		return rf(ctx, id, i, upsert)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, *models.ItemCreateRequest, bool) bool); ok {
+		r0 = rf(ctx, id, i, upsert)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, *models.ItemCreateRequest, bool) error); ok {
+		r1 = rf(ctx, id, i, upsert)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SimilarItems provides a mock function with given fields: ctx, name, threshold, limit
+func (_m *StorageInt) SimilarItems(ctx context.Context, name string, threshold float64, limit int) ([]models.SimilarItem, error) {
+	ret := _m.Called(ctx, name, threshold, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SimilarItems")
+	}
+
+	var r0 []models.SimilarItem
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, float64, int) ([]models.SimilarItem, error)); ok {
+		return rf(ctx, name, threshold, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, float64, int) []models.SimilarItem); ok {
+		r0 = rf(ctx, name, threshold, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.SimilarItem)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, float64, int) error); ok {
+		r1 = rf(ctx, name, threshold, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateItem provides a mock function with given fields: ctx, id, i
-func (_m *StorageInt) UpdateItem(ctx context.Context, id uuid.UUID, i *models.ItemUpdateRequest) error {
+func (_m *StorageInt) UpdateItem(ctx context.Context, id uuid.UUID, i *models.ItemUpdateRequest) (*models.ItemResponse, error) {
 	ret := _m.Called(ctx, id, i)
 
 	if len(ret) == 0 {
 		panic("no return value specified for UpdateItem")
 	}
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, *models.ItemUpdateRequest) error); ok {
+	var r0 *models.ItemResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, *models.ItemUpdateRequest) (*models.ItemResponse, error)); ok {
+		return rf(ctx, id, i)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, *models.ItemUpdateRequest) *models.ItemResponse); ok {
 		r0 = rf(ctx, id, i)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*models.ItemResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, *models.ItemUpdateRequest) error); ok {
+		r1 = rf(ctx, id, i)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WithTx provides a mock function with given fields: ctx, fn
+func (_m *StorageInt) WithTx(ctx context.Context, fn func(models.StorageInt) error) error {
+	ret := _m.Called(ctx, fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for WithTx")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, func(models.StorageInt) error) error); ok {
+		r0 = rf(ctx, fn)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -1,7 +1,9 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -31,14 +33,315 @@ type ItemResponse struct {
 	Type          string    `json:"type"`
 }
 
+// ItemCreateResponse warns about existing companies with similar names
+type ItemCreateResponse struct {
+	ItemResponse
+	Warnings []SimilarItem `json:"warnings,omitempty"`
+}
+
+// SimilarItem is a company which name looks like the requested one, Score is from 0 to 1
+type SimilarItem struct {
+	ID    uuid.UUID `json:"id"`
+	Name  string    `json:"name"`
+	Score float64   `json:"score"`
+}
+
+type SimilarItemsResponse struct {
+	Items []SimilarItem `json:"items"`
+}
+
+type BatchGetRequest struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+type BatchGetResponse struct {
+	Items   []ItemResponse `json:"items"`
+	Missing []uuid.UUID    `json:"missing"`
+}
+
+// ItemFilter limits set of companies, empty fields are ignored
+type ItemFilter struct {
+	Name         string
+	Type         string
+	IsRegistered *bool
+	MinEmployees *int
+	MaxEmployees *int
+}
+
+type ItemRevision struct {
+	Revision  int          `json:"revision"`
+	Event     string       `json:"event"`
+	Item      ItemResponse `json:"item"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Change is an entry of the changes feed, Item is the state after the change or the last state for deleted item
+type Change struct {
+	Seq       int64        `json:"seq"`
+	ID        uuid.UUID    `json:"id"`
+	Revision  int          `json:"revision"`
+	Event     string       `json:"event"`
+	Item      ItemResponse `json:"item"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// ChangesResponse contains changes in sequence order, Next should be passed as "since" to get the following page
+type ChangesResponse struct {
+	Changes []Change `json:"changes"`
+	Next    int64    `json:"next"`
+}
+
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type ItemDiffResponse struct {
+	ID    uuid.UUID        `json:"id"`
+	From  int              `json:"from"`
+	To    int              `json:"to"`
+	Patch []PatchOperation `json:"patch"`
+}
+
+type RollbackRequest struct {
+	Revision int `json:"revision"`
+}
+
+// MergeRequest merges source company into the one from URL, which survives
+type MergeRequest struct {
+	SourceID uuid.UUID     `json:"source_id"`
+	Strategy MergeStrategy `json:"strategy"`
+}
+
+// MergeStrategy tells how to pick every field of the merged company, empty means MergeTarget
+type MergeStrategy struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	EmployeeCount string `json:"employee_count"`
+	IsRegistered  string `json:"is_registered"`
+	Type          string `json:"type"`
+}
+
+type Identity struct {
+	Subject   string
+	Roles     []string
+	ExpiresAt time.Time
+}
+
+func (i *Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type AuditRecord struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	CompanyID string    `json:"company_id,omitempty"`
+	Principal string    `json:"principal"`
+	Status    int       `json:"status"`
+	ClientIP  string    `json:"client_ip"`
+	RequestID string    `json:"request_id"`
+}
+
+type AuditFilter struct {
+	CompanyID string
+	Principal string
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+}
+
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchOperation struct {
+	Op   string          `json:"op"`
+	ID   *uuid.UUID      `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+type BatchResult struct {
+	Index         int           `json:"index"`
+	Op            string        `json:"op"`
+	ID            *uuid.UUID    `json:"id,omitempty"`
+	Status        int           `json:"status"`
+	Error         string        `json:"error,omitempty"`
+	ConflictingID *uuid.UUID    `json:"conflicting_id,omitempty"`
+	Item          *ItemResponse `json:"item,omitempty"`
+}
+
+// BatchItem is a validated batch operation passed to storage
+type BatchItem struct {
+	Op     string
+	ID     uuid.UUID
+	Create *ItemCreateRequest
+	Update *ItemUpdateRequest
+}
+
+type BatchItemResult struct {
+	Item *ItemResponse
+	Err  error
+}
+
+// CacheStats are counters of companies cache since service start
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	NegativeHits  uint64
+	Evictions     uint64
+	Invalidations uint64
+	Size          int
+}
+
+type ItemStats struct {
+	Total          int               `json:"total"`
+	ByType         map[string]int    `json:"by_type"`
+	ByRegistration RegistrationStats `json:"by_registration"`
+	EmployeeCount  EmployeeStats     `json:"employee_count"`
+	Histogram      []HistogramBucket `json:"histogram"`
+}
+
+type RegistrationStats struct {
+	Registered   int `json:"registered"`
+	Unregistered int `json:"unregistered"`
+}
+
+type EmployeeStats struct {
+	Sum int64   `json:"sum"`
+	Avg float64 `json:"avg"`
+	Min int     `json:"min"`
+	Max int     `json:"max"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// HistogramBucket counts items with From <= employee_count < To, missing bound means unlimited
+type HistogramBucket struct {
+	From  *int `json:"from,omitempty"`
+	To    *int `json:"to,omitempty"`
+	Count int  `json:"count"`
+}
+
+type ImportJob struct {
+	ID            uuid.UUID        `json:"id"`
+	Status        string           `json:"status"`
+	Format        string           `json:"format"`
+	TotalRows     int              `json:"total_rows"`
+	ProcessedRows int              `json:"processed_rows"`
+	CreatedRows   int              `json:"created_rows"`
+	FailedRows    int              `json:"failed_rows"`
+	Error         string           `json:"error,omitempty"`
+	Errors        []ImportRowError `json:"errors"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+	Payload       []byte           `json:"-"`
+	// Epoch is incremented on every claim, progress is saved only by the worker holding the latest one
+	Epoch int `json:"-"`
+}
+
+type ImportSubmitResponse struct {
+	ID     uuid.UUID `json:"id"`
+	Status string    `json:"status"`
+}
+
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Webhook is a subscription to company events, empty Events means all events
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"-"`
+	Enabled   bool      `json:"enabled"`
+	Failures  int       `json:"failures"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookRequest struct {
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Secret  string   `json:"secret"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// WebhookDelivery is a single delivery attempt, Status is 0 if no response was received
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	WebhookID  uuid.UUID `json:"webhook_id"`
+	CompanyID  uuid.UUID `json:"company_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// company which already has the same normalized name
+	ConflictingID *uuid.UUID `json:"conflicting_id,omitempty"`
+	// companies with similar names which caused rejection in strict mode
+	Matches []SimilarItem `json:"matches,omitempty"`
 }
 
 type EventNotifications struct {
 	ID        uuid.UUID `json:"id"`
 	Event     string    `json:"event"`
 	Timestamp int64     `json:"timestamp"`
+	// company merged into ID, only for merged event
+	MergedFrom *uuid.UUID `json:"merged_from,omitempty"`
+}
+
+// Event is a notification with its position in the event log
+type Event struct {
+	ID   string
+	Data EventNotifications
+}
+
+// EventSubscription delivers Backlog first, then live events from C.
+// C is closed if subscriber is too slow, Reset is set if some events requested for resume are not available anymore.
+type EventSubscription struct {
+	Backlog []Event
+	Reset   bool
+	C       <-chan Event
+	Cancel  func()
+}
+
+// WSRequest is a WebSocket client command, action is "subscribe" or "unsubscribe"
+type WSRequest struct {
+	Action string      `json:"action"`
+	IDs    []uuid.UUID `json:"ids"`
+}
+
+// WSMessage is sent to WebSocket client, type is "snapshot", "event" or "error"
+type WSMessage struct {
+	Type       string        `json:"type"`
+	ID         *uuid.UUID    `json:"id,omitempty"`
+	Event      string        `json:"event,omitempty"`
+	MergedFrom *uuid.UUID    `json:"merged_from,omitempty"`
+	Timestamp  int64         `json:"timestamp,omitempty"`
+	Item       *ItemResponse `json:"item,omitempty"`
+	Error      string        `json:"error,omitempty"`
 }
 
 var AcceptableLegalTypes = map[string]struct{}{
@@ -49,25 +352,83 @@ var AcceptableLegalTypes = map[string]struct{}{
 }
 
 var (
-	ErrNotFound           = errors.New("Item not found")
-	ErrNothingToDo        = errors.New("Empty request - nothing to do")
-	ErrDuplicateName      = errors.New("Duplicate item name")
-	ErrInvalidID          = errors.New("Invalid id")
-	ErrInvalidName        = errors.New("Invalid name")
-	ErrInvalidDescription = errors.New("Invalid description")
-	ErrInvalidType        = errors.New("Invalid type")
-	ErrInvalidRequest     = errors.New("Invalid request")
-	ErrDBError            = errors.New("DB error")
-	ErrJWTInvalid         = errors.New("Invalid JWT")
-	ErrJWTRoleMissing     = errors.New("Access denied")
-	ErrJWTInvalidMethod   = errors.New("Invalid signing method")
+	ErrNotFound             = errors.New("Item not found")
+	ErrNothingToDo          = errors.New("Empty request - nothing to do")
+	ErrDuplicateName        = errors.New("Duplicate item name")
+	ErrSimilarName          = errors.New("Item with similar name exists")
+	ErrInvalidID            = errors.New("Invalid id")
+	ErrInvalidName          = errors.New("Invalid name")
+	ErrInvalidDescription   = errors.New("Invalid description")
+	ErrInvalidEmployeeCount = errors.New("Invalid employee count")
+	ErrInvalidType          = errors.New("Invalid type")
+	ErrInvalidRequest       = errors.New("Invalid request")
+	ErrInvalidRevision      = errors.New("Invalid revision")
+	ErrInvalidStrategy      = errors.New("Invalid merge strategy")
+	ErrMergeItself          = errors.New("Item could not be merged into itself")
+	ErrInvalidFilter        = errors.New("Invalid filter")
+	ErrInvalidPatch         = errors.New("Invalid patch")
+	ErrPatchTestFailed      = errors.New("Patch test failed")
+	ErrUnsupportedMedia     = errors.New("Unsupported content type")
+	ErrNotAcceptable        = errors.New("Requested format is not supported")
+	ErrPayloadTooLarge      = errors.New("Payload is too large")
+	ErrInvalidURL           = errors.New("Invalid URL")
+	ErrInvalidEvent         = errors.New("Invalid event type")
+	ErrInvalidSecret        = errors.New("Invalid secret")
+	ErrQueueFull            = errors.New("Queue is full")
+	ErrLeaseLost            = errors.New("Job is claimed by another worker")
+	ErrInvalidOperation     = errors.New("Invalid operation")
+	ErrBatchTooLarge        = errors.New("Too many operations in batch")
+	ErrBatchAborted         = errors.New("Batch aborted")
+	ErrDBError              = errors.New("DB error")
+	ErrDBTimeout            = errors.New("DB timeout")
+	ErrDBUnavailable        = errors.New("DB unavailable")
+	ErrJWTInvalid           = errors.New("Invalid JWT")
+	ErrJWTRoleMissing       = errors.New("Access denied")
+	ErrJWTInvalidMethod     = errors.New("Invalid signing method")
 )
 
+// DuplicateNameError is ErrDuplicateName which knows the company already having the same name key
+type DuplicateNameError struct {
+	ID uuid.UUID
+}
+
+func (e *DuplicateNameError) Error() string {
+	return ErrDuplicateName.Error()
+}
+
+func (e *DuplicateNameError) Is(target error) bool {
+	return target == ErrDuplicateName
+}
+
 const (
-	RoleReader = "reader"
-	RoleWriter = "writer"
+	RoleReader  = "reader"
+	RoleWriter  = "writer"
+	RoleAuditor = "auditor"
 
 	EventTypeCreated = "created"
 	EventTypeUpdated = "updated"
 	EventTypeDeleted = "deleted"
+	EventTypeMerged  = "merged"
+
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+
+	// MergeTarget keeps value of the surviving company, MergeSource takes value of the merged one,
+	// others pick one of both values: MergeLongest for text fields, MergeMax and MergeSum for employee count,
+	// MergeAny for registration flag
+	MergeTarget  = "target"
+	MergeSource  = "source"
+	MergeLongest = "longest"
+	MergeMax     = "max"
+	MergeSum     = "sum"
+	MergeAny     = "any"
+
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
 )
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// legalSuffixes are legal forms ignored at the end of a name, dots are removed before lookup, so "L.L.C." is "llc"
+var legalSuffixes = map[string]struct{}{
+	"ab": {}, "ag": {}, "bv": {}, "co": {}, "corp": {}, "corporation": {}, "gmbh": {}, "inc": {},
+	"incorporated": {}, "limited": {}, "llc": {}, "llp": {}, "lp": {}, "ltd": {}, "nv": {}, "oy": {},
+	"plc": {}, "pty": {}, "sa": {}, "sarl": {}, "srl": {},
+}
+
+// NameKey is the form of company name which must be unique: NFKC normalized, case folded,
+// with trimmed and collapsed whitespace. With stripSuffixes trailing legal forms are removed,
+// so "Acme, Inc." and "ACME" have the same key.
+func NameKey(name string, stripSuffixes bool) string {
+	key := cases.Fold().String(norm.NFKC.String(name))
+	key = strings.Join(strings.Fields(key), " ")
+	if !stripSuffixes {
+		return key
+	}
+	for {
+		n := strings.LastIndexByte(key, ' ')
+		if n < 0 {
+			return key
+		}
+		suffix := strings.ReplaceAll(strings.Trim(key[n+1:], ".,"), ".", "")
+		if _, ok := legalSuffixes[suffix]; !ok {
+			return key
+		}
+		rest := strings.TrimRight(key[:n], " ,")
+		if rest == "" {
+			return key
+		}
+		key = rest
+	}
+}
+
+// NameSimilarity compares name keys by Levenshtein distance, 1 means equal keys and 0 means nothing in common
+func NameSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(ra) == 0 {
+		return 1
+	}
+	// one row of the distance matrix is enough
+	row := make([]int, len(rb)+1)
+	for k := range row {
+		row[k] = k
+	}
+	for n := 1; n <= len(ra); n++ {
+		prev := row[0]
+		row[0] = n
+		for k := 1; k <= len(rb); k++ {
+			cost := 1
+			if ra[n-1] == rb[k-1] {
+				cost = 0
+			}
+			cur := min(row[k]+1, row[k-1]+1, prev+cost)
+			prev, row[k] = row[k], cur
+		}
+	}
+	return 1 - float64(row[len(rb)])/float64(len(ra))
+}
+
+// SimilarLengths returns range of key lengths in runes which could have NameSimilarity with a key of n runes
+// at least threshold, the distance is never less than the difference of lengths
+func SimilarLengths(n int, threshold float64) (int, int) {
+	if threshold <= 0 {
+		return 0, math.MaxInt32
+	}
+	// epsilon keeps bounds which are exact in decimal from being lost to float rounding
+	const eps = 1e-9
+	return int(math.Ceil(threshold*float64(n) - eps)), int(math.Floor(float64(n)/threshold + eps))
+}
+
+// SortSimilar orders matches best first and keeps at most limit of them
+func SortSimilar(list []SimilarItem, limit int) []SimilarItem {
+	sort.Slice(list, func(n, k int) bool {
+		if list[n].Score != list[k].Score {
+			return list[n].Score > list[k].Score
+		}
+		return list[n].ID.String() < list[k].ID.String()
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
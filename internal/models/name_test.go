@@ -0,0 +1,54 @@
+package models_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+func TestNameKey(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		stripSuffixes bool
+		key           string
+	}{
+		{"Acme", false, "acme"},
+		{"  ACME  Trading\t", false, "acme trading"},
+		{"Ａｃｍｅ", false, "acme"},
+		{"Straße", false, "strasse"},
+		{"Acme Ltd", false, "acme ltd"},
+		{"Acme, Inc.", true, "acme"},
+		{"Acme Pty Ltd", true, "acme"},
+		{"Acme L.L.C.", true, "acme"},
+		{"Inc", true, "inc"},
+		{"Acme Incubator", true, "acme incubator"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.key, models.NameKey(tc.name, tc.stripSuffixes))
+		})
+	}
+}
+
+func TestSimilarLengths(t *testing.T) {
+	for _, tc := range []struct {
+		n         int
+		threshold float64
+		lo, hi    int
+	}{
+		{12, 0.5, 6, 24},
+		{10, 0.8, 8, 12},
+		{3, 0.3, 1, 10},
+		{0, 0.5, 0, 0},
+		{5, 0, 0, math.MaxInt32},
+	} {
+		t.Run(fmt.Sprintf("%d_%v", tc.n, tc.threshold), func(t *testing.T) {
+			lo, hi := models.SimilarLengths(tc.n, tc.threshold)
+			assert.Equal(t, tc.lo, lo)
+			assert.Equal(t, tc.hi, hi)
+		})
+	}
+}
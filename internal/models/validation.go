@@ -0,0 +1,130 @@
+package models
+
+import (
+	"math"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxNameLength        = 15
+	maxDescriptionLength = 3000
+	minSecretLength      = 16
+	// employee_count column is int
+	maxEmployeeCount = math.MaxInt32
+)
+
+func (r *ItemCreateRequest) Validate() error {
+	if !validName(r.Name) {
+		return ErrInvalidName
+	}
+	if !validDescription(r.Description) {
+		return ErrInvalidDescription
+	}
+	if !validEmployeeCount(r.EmployeeCount) {
+		return ErrInvalidEmployeeCount
+	}
+	if !validType(r.Type) {
+		return ErrInvalidType
+	}
+	return nil
+}
+
+func (r *ItemUpdateRequest) Validate() error {
+	if r.Name == nil && r.Description == nil && r.EmployeeCount == nil && r.IsRegistered == nil && r.Type == nil {
+		return ErrNothingToDo
+	}
+	if r.Name != nil && !validName(*r.Name) {
+		return ErrInvalidName
+	}
+	if r.Description != nil && !validDescription(*r.Description) {
+		return ErrInvalidDescription
+	}
+	if r.EmployeeCount != nil && !validEmployeeCount(*r.EmployeeCount) {
+		return ErrInvalidEmployeeCount
+	}
+	if r.Type != nil && !validType(*r.Type) {
+		return ErrInvalidType
+	}
+	return nil
+}
+
+func (r *WebhookRequest) Validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	// names are resolved again on every delivery, so here only obviously internal hosts are rejected
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrInvalidURL
+	}
+	if ip := net.ParseIP(host); ip != nil && !PublicIP(ip) {
+		return ErrInvalidURL
+	}
+	for _, e := range r.Events {
+		if e != EventTypeCreated && e != EventTypeUpdated && e != EventTypeDeleted && e != EventTypeMerged {
+			return ErrInvalidEvent
+		}
+	}
+	if len(r.Secret) < minSecretLength {
+		return ErrInvalidSecret
+	}
+	return nil
+}
+
+// PublicIP is false for loopback, private, link-local and other addresses which are not reachable from the internet
+func PublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+// carrier-grade NAT, RFC 6598
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func (r *MergeRequest) Validate() error {
+	if r.SourceID == uuid.Nil {
+		return ErrInvalidID
+	}
+	s := &r.Strategy
+	if !validStrategy(s.Name, MergeLongest) || !validStrategy(s.Description, MergeLongest) ||
+		!validStrategy(s.EmployeeCount, MergeMax, MergeSum) || !validStrategy(s.IsRegistered, MergeAny) ||
+		!validStrategy(s.Type) {
+		return ErrInvalidStrategy
+	}
+	return nil
+}
+
+// validStrategy accepts common strategies and field-specific ones listed in extra
+func validStrategy(s string, extra ...string) bool {
+	if s == "" || s == MergeTarget || s == MergeSource {
+		return true
+	}
+	for _, e := range extra {
+		if s == e {
+			return true
+		}
+	}
+	return false
+}
+
+func validName(name string) bool {
+	return name != "" && utf8.RuneCountInString(name) <= maxNameLength
+}
+
+func validDescription(description string) bool {
+	return utf8.RuneCountInString(description) <= maxDescriptionLength
+}
+
+func validEmployeeCount(n int) bool {
+	return n >= 0 && n <= maxEmployeeCount
+}
+
+func validType(t string) bool {
+	_, ok := AcceptableLegalTypes[t]
+	return ok
+}
@@ -0,0 +1,160 @@
+package notify
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	SinkKafka   = "kafka"
+	SinkWebhook = "webhook"
+	SinkLog     = "log"
+	SinkFile    = "file"
+
+	// PolicyFail makes Send return error, so the request fails
+	PolicyFail = "fail"
+	// PolicyLog only logs the error
+	PolicyLog = "log"
+	// PolicyDeadLetter saves the event to dead-letter file, Send fails only if it could not be saved
+	PolicyDeadLetter = "dead-letter"
+)
+
+var (
+	ErrInvalidSinks    = errors.New("invalid sinks configuration")
+	ErrNoDeadLetter    = errors.New("dead-letter file is not configured")
+	errDeadLetterWrite = errors.New("dead-letter write failed")
+)
+
+// Sink is a notifier with its name and failure policy
+type Sink struct {
+	Name     string
+	Policy   string
+	Notifier models.NotifyInt
+}
+
+// DeadLetter is a record of dead-letter file
+type DeadLetter struct {
+	Time  time.Time                 `json:"time"`
+	Sink  string                    `json:"sink"`
+	Error string                    `json:"error"`
+	Event models.EventNotifications `json:"event"`
+}
+
+// ParseSinks reads comma-separated list of "name:policy", policy is "log" if omitted.
+// Notifiers of returned sinks should be set by caller.
+func ParseSinks(v string) ([]Sink, error) {
+	var res []Sink
+	seen := map[string]struct{}{}
+	for _, s := range strings.Split(v, ",") {
+		name, policy, _ := strings.Cut(strings.TrimSpace(s), ":")
+		if policy == "" {
+			policy = PolicyLog
+		}
+		switch name {
+		case SinkKafka, SinkWebhook, SinkLog, SinkFile:
+		default:
+			return nil, ErrInvalidSinks
+		}
+		switch policy {
+		case PolicyFail, PolicyLog, PolicyDeadLetter:
+		default:
+			return nil, ErrInvalidSinks
+		}
+		if _, ok := seen[name]; ok {
+			return nil, ErrInvalidSinks
+		}
+		seen[name] = struct{}{}
+		res = append(res, Sink{Name: name, Policy: policy})
+	}
+	return res, nil
+}
+
+// HasSink is true if sinks contain one with the name
+func HasSink(sinks []Sink, name string) bool {
+	for _, s := range sinks {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// multi dispatches every event to all sinks in parallel
+type multi struct {
+	log        *zerolog.Logger
+	sinks      []Sink
+	deadLetter *file
+}
+
+// New returns composite notifier, deadLetterPath is required if any sink has dead-letter policy
+func New(log *zerolog.Logger, deadLetterPath string, sinks []Sink) (*multi, error) {
+	m := multi{log: log, sinks: sinks}
+	for _, s := range sinks {
+		if s.Policy != PolicyDeadLetter || m.deadLetter != nil {
+			continue
+		}
+		if deadLetterPath == "" {
+			return nil, ErrNoDeadLetter
+		}
+		f, err := NewFile(deadLetterPath)
+		if err != nil {
+			return nil, err
+		}
+		m.deadLetter = f
+	}
+	return &m, nil
+}
+
+// Send waits for all sinks and returns error if any sink with fail policy has failed
+// or the event could not be saved to dead-letter file
+func (m *multi) Send(event models.EventNotifications) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+
+	errs := make([]error, len(m.sinks))
+	var wg sync.WaitGroup
+	for n := range m.sinks {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			errs[n] = m.sinks[n].Notifier.Send(event)
+		}(n)
+	}
+	wg.Wait()
+
+	var res []error
+	for n, err := range errs {
+		if err == nil {
+			continue
+		}
+		s := &m.sinks[n]
+		m.log.Err(err).Str("Sink", s.Name).Str("Policy", s.Policy).Msg("notification sink failed")
+		switch s.Policy {
+		case PolicyFail:
+			res = append(res, err)
+		case PolicyDeadLetter:
+			dlErr := m.deadLetter.write(DeadLetter{Time: time.Now(), Sink: s.Name, Error: err.Error(), Event: event})
+			if dlErr != nil {
+				m.log.Err(dlErr).Str("Sink", s.Name).Msg("dead-letter write failed")
+				res = append(res, errDeadLetterWrite)
+			}
+		}
+	}
+	return errors.Join(res...)
+}
+
+func (m *multi) Close() {
+	for _, s := range m.sinks {
+		s.Notifier.Close()
+	}
+	if m.deadLetter != nil {
+		m.deadLetter.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+	"github.com/mannulus-immortalis/xmtask/internal/models/mocks"
+	"github.com/mannulus-immortalis/xmtask/internal/notify"
+)
+
+func TestNotifySinks(t *testing.T) {
+	t.Run("error_fail_policy", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock kafka, the failed sink is reported, the other one still gets the event with timestamp set
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", mock.Anything).Return(errors.New("kafka is down"))
+		fileMock := mocks.NewNotifyInt(t)
+		fileMock.On("Send", mock.MatchedBy(func(e models.EventNotifications) bool {
+			return e.ID == id && e.Event == models.EventTypeCreated && e.Timestamp > 0
+		})).Return(nil)
+		notifier, err := notify.New(&log, "", []notify.Sink{
+			{Name: notify.SinkKafka, Policy: notify.PolicyFail, Notifier: kafkaMock},
+			{Name: notify.SinkFile, Policy: notify.PolicyLog, Notifier: fileMock},
+		})
+		assert.NoError(t, err)
+
+		// send event
+		err = notifier.Send(models.EventNotifications{ID: id, Event: models.EventTypeCreated})
+
+		// test result
+		assert.EqualError(t, err, "kafka is down")
+	})
+
+	t.Run("success_log_policy", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", mock.Anything).Return(errors.New("kafka is down"))
+		notifier, err := notify.New(&log, "", []notify.Sink{
+			{Name: notify.SinkKafka, Policy: notify.PolicyLog, Notifier: kafkaMock},
+		})
+		assert.NoError(t, err)
+
+		// send event
+		err = notifier.Send(models.EventNotifications{ID: id, Event: models.EventTypeCreated})
+
+		// test result
+		assert.NoError(t, err)
+	})
+
+	t.Run("success_dead_letter", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		deadLetterPath := filepath.Join(t.TempDir(), "dead-letter.ndjson")
+
+		// mock kafka
+		kafkaMock := mocks.NewNotifyInt(t)
+		kafkaMock.On("Send", mock.Anything).Return(errors.New("kafka is down"))
+		notifier, err := notify.New(&log, deadLetterPath, []notify.Sink{
+			{Name: notify.SinkKafka, Policy: notify.PolicyDeadLetter, Notifier: kafkaMock},
+		})
+		assert.NoError(t, err)
+
+		// send event
+		err = notifier.Send(models.EventNotifications{ID: id, Event: models.EventTypeCreated})
+
+		// test result
+		assert.NoError(t, err)
+		data, err := os.ReadFile(deadLetterPath)
+		assert.NoError(t, err)
+		var record notify.DeadLetter
+		assert.NoError(t, json.Unmarshal(data, &record))
+		assert.Equal(t, "kafka", record.Sink)
+		assert.Equal(t, "kafka is down", record.Error)
+		assert.Equal(t, id, record.Event.ID)
+		assert.Equal(t, models.EventTypeCreated, record.Event.Event)
+	})
+
+	t.Run("error_no_dead_letter_path", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// make notifier
+		_, err := notify.New(&log, "", []notify.Sink{
+			{Name: notify.SinkKafka, Policy: notify.PolicyDeadLetter, Notifier: mocks.NewNotifyInt(t)},
+		})
+
+		// test result
+		assert.ErrorIs(t, err, notify.ErrNoDeadLetter)
+	})
+}
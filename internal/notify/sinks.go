@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+// logSink writes events to service log
+type logSink struct {
+	log *zerolog.Logger
+}
+
+func NewLog(log *zerolog.Logger) *logSink {
+	return &logSink{log: log}
+}
+
+func (l *logSink) Send(event models.EventNotifications) error {
+	l.log.Info().Interface("Event", event).Msg("notification")
+	return nil
+}
+
+func (l *logSink) Close() {}
+
+// file appends events to NDJSON file
+type file struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFile(path string) (*file, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &file{f: f}, nil
+}
+
+func (f *file) Send(event models.EventNotifications) error {
+	return f.write(event)
+}
+
+func (f *file) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.f.Write(data)
+	return err
+}
+
+func (f *file) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_ = f.f.Close()
+}
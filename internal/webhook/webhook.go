@@ -0,0 +1,366 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+)
+
+const (
+	HeaderSignature = "X-Signature"
+	HeaderWebhookID = "X-Webhook-ID"
+	HeaderEvent     = "X-Event-Type"
+	HeaderAttempt   = "X-Delivery-Attempt"
+
+	defaultAttempts    = 5
+	defaultBackoff     = time.Second
+	maxBackoff         = time.Minute
+	defaultMaxFailures = 10
+	defaultTimeout     = 10 * time.Second
+	defaultRetention   = 7 * 24 * time.Hour
+
+	queueSize = 1000
+	// events waiting for delivery to one webhook, the ones above are dropped
+	webhookQueueSize = 1000
+	parallelism      = 16
+	pruneInterval    = time.Hour
+)
+
+var errPrivateAddress = errors.New("webhook address is not public")
+
+type webhook struct {
+	log  *zerolog.Logger
+	stor models.WebhookStorageInt
+	http *http.Client
+
+	attempts    int
+	backoff     time.Duration
+	maxFailures int
+	retention   time.Duration
+
+	queue chan models.EventNotifications
+	sem   chan struct{}
+	// pending deliveries per webhook, webhook is present while its worker runs
+	mu      sync.Mutex
+	pending map[uuid.UUID][]delivery
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+type delivery struct {
+	hook  models.Webhook
+	event models.EventNotifications
+	body  []byte
+}
+
+type Option func(w *webhook)
+
+// WithRetries sets number of delivery attempts and the delay before the first retry, it doubles on every next one
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(w *webhook) {
+		w.attempts = attempts
+		w.backoff = backoff
+	}
+}
+
+// WithMaxFailures sets number of consecutive failed deliveries after which webhook is disabled
+func WithMaxFailures(n int) Option {
+	return func(w *webhook) {
+		w.maxFailures = n
+	}
+}
+
+// WithDeliveryRetention sets how long delivery log is kept, 0 keeps it forever
+func WithDeliveryRetention(d time.Duration) Option {
+	return func(w *webhook) {
+		w.retention = d
+	}
+}
+
+// WithPrivateAddresses allows delivery to loopback and private networks, for local development only
+func WithPrivateAddresses() Option {
+	return func(w *webhook) {
+		w.http = newHTTPClient(nil)
+	}
+}
+
+// WithHTTPClient replaces default HTTP client, which refuses to connect to non-public addresses,
+// the client is responsible for such checks then
+func WithHTTPClient(c *http.Client) Option {
+	return func(w *webhook) {
+		w.http = c
+	}
+}
+
+// New returns notifier which delivers events to subscribed webhooks in background
+func New(log *zerolog.Logger, stor models.WebhookStorageInt, opts ...Option) *webhook {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := webhook{
+		log:  log,
+		stor: stor,
+		http: newHTTPClient(denyPrivateAddress),
+
+		attempts:    defaultAttempts,
+		backoff:     defaultBackoff,
+		maxFailures: defaultMaxFailures,
+		retention:   defaultRetention,
+
+		queue:   make(chan models.EventNotifications, queueSize),
+		sem:     make(chan struct{}, parallelism),
+		pending: map[uuid.UUID][]delivery{},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for _, opt := range opts {
+		opt(&w)
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.run()
+	}()
+	if w.retention > 0 {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.prune()
+		}()
+	}
+	return &w
+}
+
+// newHTTPClient checks every address the client connects to, including redirects and DNS answers
+// which changed since the webhook URL was validated; proxies are not used, so the check sees the real address
+func newHTTPClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{Timeout: defaultTimeout, KeepAlive: 30 * time.Second, Control: control}).DialContext
+	return &http.Client{Timeout: defaultTimeout, Transport: t}
+}
+
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !models.PublicIP(ip) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// Send queues event for delivery, it does not wait for webhooks to respond
+func (w *webhook) Send(event models.EventNotifications) error {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+	select {
+	case w.queue <- event:
+		return nil
+	default:
+		w.log.Error().Interface("Event", event).Msg("webhook queue is full, event is dropped")
+		return models.ErrQueueFull
+	}
+}
+
+// Close stops deliveries, pending retries are abandoned
+func (w *webhook) Close() {
+	w.once.Do(func() {
+		w.cancel()
+		w.wg.Wait()
+	})
+}
+
+func (w *webhook) run() {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case event := <-w.queue:
+			w.dispatch(event)
+		}
+	}
+}
+
+// dispatch queues delivery of event to every enabled webhook subscribed to it,
+// every webhook gets its events one by one in the order they were sent
+func (w *webhook) dispatch(event models.EventNotifications) {
+	list, err := w.stor.ListWebhooks(w.ctx)
+	if err != nil {
+		w.log.Err(err).Msg("webhooks select request failed")
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		w.log.Err(err).Interface("Event", event).Msg("failed to marshal event")
+		return
+	}
+
+	for _, h := range list {
+		if !h.Enabled || !subscribed(&h, event.Event) {
+			continue
+		}
+		w.mu.Lock()
+		pending, running := w.pending[h.ID]
+		if len(pending) >= webhookQueueSize {
+			w.mu.Unlock()
+			w.log.Error().Str("WebhookID", h.ID.String()).Interface("Event", event).Msg("webhook queue is full, event is dropped")
+			continue
+		}
+		w.pending[h.ID] = append(pending, delivery{hook: h, event: event, body: body})
+		w.mu.Unlock()
+
+		if !running {
+			w.wg.Add(1)
+			go func(id uuid.UUID) {
+				defer w.wg.Done()
+				w.worker(id)
+			}(h.ID)
+		}
+	}
+}
+
+// worker delivers pending events of one webhook and exits when there are none left
+func (w *webhook) worker(id uuid.UUID) {
+	for {
+		w.mu.Lock()
+		pending := w.pending[id]
+		if len(pending) == 0 || w.ctx.Err() != nil {
+			delete(w.pending, id)
+			w.mu.Unlock()
+			return
+		}
+		d := pending[0]
+		w.pending[id] = pending[1:]
+		w.mu.Unlock()
+
+		select {
+		case <-w.ctx.Done():
+			continue
+		case w.sem <- struct{}{}:
+		}
+		w.deliver(&d.hook, &d.event, d.body)
+		<-w.sem
+	}
+}
+
+// prune deletes delivery log older than retention
+func (w *webhook) prune() {
+	t := time.NewTicker(pruneInterval)
+	defer t.Stop()
+	for {
+		n, err := w.stor.DeleteWebhookDeliveries(w.ctx, time.Now().Add(-w.retention))
+		if err != nil && w.ctx.Err() == nil {
+			w.log.Err(err).Msg("webhook delivery log cleanup failed")
+		} else if n > 0 {
+			w.log.Info().Int64("Deleted", n).Msg("webhook delivery log is cleaned up")
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// deliver posts event with retries, every attempt is recorded in delivery log
+func (w *webhook) deliver(h *models.Webhook, event *models.EventNotifications, body []byte) {
+	log := w.log.With().Str("WebhookID", h.ID.String()).Logger()
+	backoff := w.backoff
+	success := false
+	for attempt := 1; attempt <= w.attempts && !success; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+		}
+
+		d := models.WebhookDelivery{WebhookID: h.ID, CompanyID: event.ID, Event: event.Event, Attempt: attempt}
+		start := time.Now()
+		d.Status, d.Error = w.post(h, event.Event, attempt, body)
+		d.DurationMs = time.Since(start).Milliseconds()
+		success = d.Error == ""
+		if !success {
+			log.Error().Int("Attempt", attempt).Int("Status", d.Status).Str("Error", d.Error).Msg("webhook delivery failed")
+		}
+
+		err := w.stor.AddWebhookDelivery(w.ctx, &d)
+		if err != nil {
+			log.Err(err).Msg("webhook delivery log insert failed")
+		}
+	}
+
+	err := w.stor.RecordWebhookResult(w.ctx, h.ID, success, w.maxFailures)
+	if err != nil {
+		log.Err(err).Msg("webhook result update failed")
+	}
+}
+
+// post sends a single request, returns response status and error description, the latter is empty on success
+func (w *webhook) post(h *models.Webhook, event string, attempt int, body []byte) (int, string) {
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, Sign(h.Secret, body))
+	req.Header.Set(HeaderWebhookID, h.ID.String())
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderAttempt, strconv.Itoa(attempt))
+
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, "unexpected status " + resp.Status
+	}
+	return resp.StatusCode, ""
+}
+
+// Sign returns value of signature header: "sha256=" and hex-encoded HMAC-SHA256 of body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribed(h *models.Webhook, event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
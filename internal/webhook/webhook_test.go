@@ -0,0 +1,195 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mannulus-immortalis/xmtask/internal/models"
+	"github.com/mannulus-immortalis/xmtask/internal/models/mocks"
+	"github.com/mannulus-immortalis/xmtask/internal/webhook"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	t.Run("success_retry", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		webhookID := uuid.MustParse("0b8e1b1e-3c5f-4a57-a3c6-4f0d0d2f6a11")
+		secret := "0123456789abcdef"
+
+		// receiver fails the first attempt
+		type delivery struct {
+			header http.Header
+			body   []byte
+		}
+		received := make(chan delivery, 10)
+		attempts := 0
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received <- delivery{header: r.Header, body: body}
+			attempts++
+			if attempts == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer receiver.Close()
+
+		// mock db
+		done := make(chan struct{})
+		webhooksMock := mocks.NewWebhookStorageInt(t)
+		webhooksMock.On("ListWebhooks", mock.Anything).Return([]models.Webhook{
+			{ID: webhookID, URL: receiver.URL, Events: []string{"updated"}, Secret: secret, Enabled: true},
+		}, nil).Twice()
+		webhooksMock.On("AddWebhookDelivery", mock.Anything, mock.MatchedBy(func(d *models.WebhookDelivery) bool {
+			return d.Attempt == 1 && d.Status == http.StatusInternalServerError && d.Error != ""
+		})).Return(nil).Once()
+		webhooksMock.On("AddWebhookDelivery", mock.Anything, mock.MatchedBy(func(d *models.WebhookDelivery) bool {
+			return d.Attempt == 2 && d.Status == http.StatusOK && d.Error == ""
+		})).Return(nil).Once()
+		webhooksMock.On("RecordWebhookResult", mock.Anything, webhookID, true, 10).Return(nil).Once().
+			Run(func(mock.Arguments) { close(done) })
+
+		// start notifier
+		notifier := webhook.New(&log, webhooksMock, webhook.WithRetries(3, time.Millisecond),
+			webhook.WithPrivateAddresses(), webhook.WithDeliveryRetention(0))
+		defer notifier.Close()
+
+		// send events, "created" is not subscribed
+		assert.NoError(t, notifier.Send(models.EventNotifications{ID: id, Event: models.EventTypeCreated, Timestamp: 1}))
+		assert.NoError(t, notifier.Send(models.EventNotifications{ID: id, Event: models.EventTypeUpdated, Timestamp: 2}))
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("delivery is not finished")
+		}
+
+		// test result
+		assert.Len(t, received, 2)
+		first := <-received
+		assert.Equal(t, "1", first.header.Get("X-Delivery-Attempt"))
+		d := <-received
+		body := `{"id":"` + id.String() + `","event":"updated","timestamp":2}`
+		assert.Equal(t, body, string(d.body))
+		assert.Equal(t, webhook.Sign(secret, []byte(body)), d.header.Get("X-Signature"))
+		assert.Equal(t, webhookID.String(), d.header.Get("X-Webhook-ID"))
+		assert.Equal(t, "2", d.header.Get("X-Delivery-Attempt"))
+	})
+
+	t.Run("success_order", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		webhookID := uuid.MustParse("0b8e1b1e-3c5f-4a57-a3c6-4f0d0d2f6a11")
+
+		// receiver is slow, so later events are sent while the first one is in flight
+		received := make(chan string, 10)
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var e models.EventNotifications
+			_ = json.NewDecoder(r.Body).Decode(&e)
+			time.Sleep(5 * time.Millisecond)
+			received <- e.ID.String()
+		}))
+		defer receiver.Close()
+
+		// mock db
+		webhooksMock := mocks.NewWebhookStorageInt(t)
+		webhooksMock.On("ListWebhooks", mock.Anything).Return([]models.Webhook{
+			{ID: webhookID, URL: receiver.URL, Secret: "0123456789abcdef", Enabled: true},
+		}, nil)
+		webhooksMock.On("AddWebhookDelivery", mock.Anything, mock.Anything).Return(nil)
+		webhooksMock.On("RecordWebhookResult", mock.Anything, webhookID, true, 10).Return(nil)
+
+		// start notifier
+		notifier := webhook.New(&log, webhooksMock, webhook.WithPrivateAddresses(), webhook.WithDeliveryRetention(0))
+		defer notifier.Close()
+
+		// send events
+		var ids []string
+		for n := 0; n < 5; n++ {
+			id := uuid.New()
+			ids = append(ids, id.String())
+			assert.NoError(t, notifier.Send(models.EventNotifications{ID: id, Event: models.EventTypeUpdated, Timestamp: 1}))
+		}
+
+		// test result
+		for _, id := range ids {
+			select {
+			case got := <-received:
+				assert.Equal(t, id, got)
+			case <-time.After(2 * time.Second):
+				t.Fatal("delivery is not finished")
+			}
+		}
+	})
+
+	t.Run("error_private_address", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+		id := uuid.MustParse("3f00e7f6-f9c8-4a3a-8a27-2bd529b161e4")
+		webhookID := uuid.MustParse("0b8e1b1e-3c5f-4a57-a3c6-4f0d0d2f6a11")
+
+		// receiver on loopback, like a name which resolves to internal address
+		received := make(chan struct{}, 10)
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- struct{}{}
+		}))
+		defer receiver.Close()
+
+		// mock db
+		done := make(chan struct{})
+		webhooksMock := mocks.NewWebhookStorageInt(t)
+		webhooksMock.On("ListWebhooks", mock.Anything).Return([]models.Webhook{
+			{ID: webhookID, URL: receiver.URL, Secret: "0123456789abcdef", Enabled: true},
+		}, nil).Once()
+		webhooksMock.On("AddWebhookDelivery", mock.Anything, mock.MatchedBy(func(d *models.WebhookDelivery) bool {
+			return d.Status == 0 && strings.Contains(d.Error, "webhook address is not public")
+		})).Return(nil).Once()
+		webhooksMock.On("RecordWebhookResult", mock.Anything, webhookID, false, 10).Return(nil).Once().
+			Run(func(mock.Arguments) { close(done) })
+
+		// start notifier
+		notifier := webhook.New(&log, webhooksMock, webhook.WithRetries(1, time.Millisecond), webhook.WithDeliveryRetention(0))
+		defer notifier.Close()
+
+		// send event
+		assert.NoError(t, notifier.Send(models.EventNotifications{ID: id, Event: models.EventTypeUpdated, Timestamp: 1}))
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("delivery is not finished")
+		}
+
+		// test result
+		assert.Len(t, received, 0)
+	})
+
+	t.Run("success_retention", func(t *testing.T) {
+		log := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+		// mock db
+		done := make(chan struct{})
+		webhooksMock := mocks.NewWebhookStorageInt(t)
+		webhooksMock.On("DeleteWebhookDeliveries", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+			return time.Until(before) < -47*time.Hour && time.Until(before) > -49*time.Hour
+		})).Return(int64(3), nil).Once().
+			Run(func(mock.Arguments) { close(done) })
+
+		// start notifier
+		notifier := webhook.New(&log, webhooksMock, webhook.WithDeliveryRetention(48*time.Hour))
+		defer notifier.Close()
+
+		// test result
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("delivery log is not cleaned up")
+		}
+	})
+}
@@ -0,0 +1,9 @@
+-- Adds normalized name key to an existing database created by init.sql before name_key column was added:
+--   psql -f migrations/0001_name_key.sql
+-- Keys are computed by the service on start with the same normalization as new names get. If several
+-- companies get the same key the service stops with their list; rename or delete them and start it again.
+BEGIN;
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS name_key text;
+CREATE UNIQUE INDEX IF NOT EXISTS companies_name_key_uniq ON companies (name_key);
+ALTER TABLE companies DROP CONSTRAINT IF EXISTS companies_name_key;
+COMMIT;
@@ -0,0 +1,14 @@
+-- Lists companies which will probably get the same name key, run it before migrations/0001_name_key.sql
+-- to rename or merge them in advance:
+--   psql -f migrations/0001_name_key_collisions.sql
+-- Read only. The key here is an approximation without legal suffix stripping and with lower() instead of
+-- case folding; the service check on start is authoritative and may still report groups not listed here.
+-- normalize() needs PostgreSQL 13 and UTF8 database encoding.
+SELECT lower(regexp_replace(btrim(normalize(name, NFKC)), '\s+', ' ', 'g')) AS name_key,
+  count(*) AS companies,
+  array_agg(id ORDER BY id) AS ids,
+  array_agg(name ORDER BY id) AS names
+FROM companies
+GROUP BY 1
+HAVING count(*) > 1
+ORDER BY 1;
@@ -0,0 +1,5 @@
+-- Adds trigram index used by similar names search to an existing database created by init.sql
+-- before it was added. Requires migrations/0001_name_key.sql, pg_trgm extension is shipped with PostgreSQL contrib:
+--   psql -f migrations/0002_name_trgm.sql
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS companies_name_key_trgm ON companies USING gin (name_key gin_trgm_ops);
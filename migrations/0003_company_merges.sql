@@ -0,0 +1,9 @@
+-- Adds table of merged companies to an existing database created by init.sql before it was added:
+--   psql -f migrations/0003_company_merges.sql
+CREATE TABLE IF NOT EXISTS company_merges (
+  source_id uuid PRIMARY KEY NOT NULL,
+  target_id uuid NOT NULL,
+  data jsonb NOT NULL,
+  merged_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS company_merges_target_id ON company_merges (target_id);
@@ -0,0 +1,90 @@
+-- Adds company revisions trail and changes feed to an existing database created by init.sql before they were added,
+-- or brings them to the current form: sequence numbers and the trigger deferred to commit which ignores name key changes.
+-- It has to be applied before the service is started with migrations/0001_name_key.sql, which fills name keys:
+--   psql -f migrations/0004_company_revisions.sql
+-- Existing companies get their current state as revision 1, so they could be diffed and rolled back like new ones.
+BEGIN;
+-- no writes until the trigger is in place, otherwise they would be missing from the trail
+LOCK TABLE companies IN SHARE ROW EXCLUSIVE MODE;
+
+CREATE TABLE IF NOT EXISTS company_revisions (
+  company_id uuid NOT NULL,
+  revision int NOT NULL,
+  event text NOT NULL,
+  data jsonb NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  seq bigint NOT NULL UNIQUE,
+  PRIMARY KEY (company_id, revision)
+);
+-- revisions recorded before the changes feed was added have no sequence numbers,
+-- they are numbered in the order they were created
+ALTER TABLE company_revisions ADD COLUMN IF NOT EXISTS seq bigint;
+UPDATE company_revisions r SET seq = n.seq
+FROM (
+  SELECT company_id, revision,
+    (SELECT COALESCE(MAX(seq), 0) FROM company_revisions) + row_number() OVER (ORDER BY created_at, company_id, revision) AS seq
+  FROM company_revisions WHERE seq IS NULL
+) n
+WHERE r.company_id = n.company_id AND r.revision = n.revision;
+ALTER TABLE company_revisions ALTER COLUMN seq SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS company_revisions_seq_key ON company_revisions (seq);
+
+INSERT INTO company_revisions (company_id, revision, event, data, seq)
+SELECT c.id, 1, 'created', jsonb_build_object(
+  'id', c.id,
+  'name', c.name,
+  'description', c.description,
+  'employee_count', c.employee_count,
+  'is_registered', c.is_registered,
+  'type', c.legal_type
+), (SELECT COALESCE(MAX(seq), 0) FROM company_revisions) + row_number() OVER (ORDER BY c.id)
+FROM companies c
+WHERE NOT EXISTS (SELECT 1 FROM company_revisions r WHERE r.company_id = c.id);
+
+CREATE OR REPLACE FUNCTION record_company_revision() RETURNS trigger AS $$
+DECLARE
+  rec companies;
+  ev text;
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    rec := NEW;
+    ev := 'created';
+  ELSIF TG_OP = 'UPDATE' THEN
+    -- only recorded columns are compared, so name keys recomputed by the service are not a change
+    IF (OLD.name, OLD.description, OLD.employee_count, OLD.is_registered, OLD.legal_type) IS NOT DISTINCT FROM
+      (NEW.name, NEW.description, NEW.employee_count, NEW.is_registered, NEW.legal_type) THEN
+      RETURN NULL;
+    END IF;
+    rec := NEW;
+    ev := 'updated';
+  ELSE
+    rec := OLD;
+    ev := 'deleted';
+  END IF;
+
+  -- global change sequence for the changes feed: the trigger is deferred to commit and writers are
+  -- serialized from here until commit, so sequence numbers become visible in order and without gaps;
+  -- the lock also protects revision numbers taken from the history of the company
+  PERFORM pg_advisory_xact_lock(hashtext('company_revisions_seq'));
+
+  INSERT INTO company_revisions (company_id, revision, event, data, seq)
+  SELECT rec.id, COALESCE(MAX(revision), 0) + 1, ev, jsonb_build_object(
+    'id', rec.id,
+    'name', rec.name,
+    'description', rec.description,
+    'employee_count', rec.employee_count,
+    'is_registered', rec.is_registered,
+    'type', rec.legal_type
+  ), (SELECT COALESCE(MAX(seq), 0) + 1 FROM company_revisions)
+  FROM company_revisions WHERE company_id = rec.id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- deferred, so the lock above is held only while the transaction commits
+DROP TRIGGER IF EXISTS companies_revisions ON companies;
+CREATE CONSTRAINT TRIGGER companies_revisions
+AFTER INSERT OR UPDATE OR DELETE ON companies
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION record_company_revision();
+COMMIT;
@@ -0,0 +1,27 @@
+-- Adds bulk import jobs to an existing database created by init.sql before they were added:
+--   psql -f migrations/0005_import_jobs.sql
+BEGIN;
+CREATE TABLE IF NOT EXISTS import_jobs (
+  id uuid PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+  status text NOT NULL,
+  format text NOT NULL,
+  payload bytea NOT NULL,
+  total_rows int NOT NULL DEFAULT 0,
+  processed_rows int NOT NULL DEFAULT 0,
+  created_rows int NOT NULL DEFAULT 0,
+  failed_rows int NOT NULL DEFAULT 0,
+  error text NOT NULL DEFAULT '',
+  -- incremented on every claim, saves of the worker which lost the lease are rejected
+  epoch int NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS import_jobs_status ON import_jobs (status, created_at);
+
+CREATE TABLE IF NOT EXISTS import_job_errors (
+  job_id uuid NOT NULL REFERENCES import_jobs (id),
+  row_num int NOT NULL,
+  error text NOT NULL,
+  PRIMARY KEY (job_id, row_num)
+);
+COMMIT;
@@ -0,0 +1,35 @@
+-- Adds append-only audit log to an existing database created by init.sql before it was added:
+--   psql -f migrations/0006_audit_log.sql
+BEGIN;
+CREATE TABLE IF NOT EXISTS audit_log (
+  id bigserial PRIMARY KEY,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  method text NOT NULL,
+  route text NOT NULL,
+  company_id text NOT NULL,
+  principal text NOT NULL,
+  status int NOT NULL,
+  client_ip text NOT NULL,
+  request_id text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_company_id ON audit_log (company_id);
+CREATE INDEX IF NOT EXISTS audit_log_principal ON audit_log (principal);
+
+-- audit log is append-only
+CREATE OR REPLACE FUNCTION reject_audit_log_change() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION reject_audit_log_change();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate
+BEFORE TRUNCATE ON audit_log
+FOR EACH STATEMENT EXECUTE FUNCTION reject_audit_log_change();
+
+COMMIT;
@@ -0,0 +1,28 @@
+-- Adds webhook subscriptions and delivery log to an existing database created by init.sql before they were added:
+--   psql -f migrations/0007_webhooks.sql
+BEGIN;
+CREATE TABLE IF NOT EXISTS webhooks (
+  id uuid PRIMARY KEY NOT NULL DEFAULT gen_random_uuid(),
+  url text NOT NULL,
+  events text[] NOT NULL,
+  secret text NOT NULL,
+  enabled bool NOT NULL DEFAULT true,
+  failures int NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id bigserial PRIMARY KEY,
+  webhook_id uuid NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+  company_id uuid NOT NULL,
+  event text NOT NULL,
+  attempt int NOT NULL,
+  status int NOT NULL,
+  error text NOT NULL,
+  duration_ms bigint NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_created_at ON webhook_deliveries (created_at);
+COMMIT;